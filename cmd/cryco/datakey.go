@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mengstr/cryco"
+)
+
+// Adds a data key header to the config files, moving their values over to the data key
+func datakey(args []string) int {
+	flags := flag.NewFlagSet("datakey", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	keyName := flags.String("key", "CRYCOKEY", "Use env <string> as the master key")
+	keyFile := flags.String("keyfile", "", "Read the master key from file <string> instead of an env")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco datakey [-key <env> | -keyfile <path>] file...\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	master, err := keyringFrom(*keyName, *keyFile, "")
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	for _, filename := range flags.Args() {
+		cnt, err := addDataKeyFile(filename, master)
+		if err != nil {
+			fmt.Fprintf(eout, "%s: %s\n", filename, err)
+			return 1
+		}
+		fmt.Fprintf(out, "%s: data key added, %d values moved to it\n", filename, cnt)
+	}
+	return 0
+}
+
+// Adds a data key to the file and atomically replaces it with the result
+func addDataKeyFile(filename string, master *cryco.Keyring) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	cnt, err := cryco.AddDataKey(&buf, bytes.NewReader(data), master)
+	if err != nil {
+		return 0, err
+	}
+	return cnt, writeFileAtomic(filename, buf.Bytes(), fi.Mode().Perm())
+}
+
+// Returns the data key from the header line of the file, decrypted using the master key
+func dataKeyFromFile(filename string, master *cryco.Keyring) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if cryco.IsDataKeyHeader(scanner.Text()) {
+			return cryco.UnwrapDataKey(master, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("No data key header in '%s', add one with 'cryco datakey'", filename)
+}
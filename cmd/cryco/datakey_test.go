@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_datakey(t *testing.T) {
+	key, _ := cryco.GenerateKeySize(cryco.KeySize128)
+	other, _ := cryco.GenerateKeySize(cryco.KeySize128)
+	os.Setenv("CRYCOTEST_MASTER", base64.URLEncoding.EncodeToString(key))
+	os.Setenv("CRYCOTEST_OTHER", base64.URLEncoding.EncodeToString(other))
+	defer os.Unsetenv("CRYCOTEST_MASTER")
+	defer os.Unsetenv("CRYCOTEST_OTHER")
+
+	sealed, _ := cryco.Encrypt(key, "secret")
+	cfg := "# Comment\nA = (clear)\nB = " + sealed + "\n"
+
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.cfg")
+	keyDir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keyDir)
+	keyFile := writeKeyFile(t, keyDir, "master", key)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantHeader bool
+	}{
+		{"no args", []string{}, 2, false},
+		{"missing key", []string{"-key", "CRYCOTEST_NONE", filename}, 1, false},
+		{"wrong key", []string{"-key", "CRYCOTEST_OTHER", filename}, 1, false},
+		{"missing file", []string{"-key", "CRYCOTEST_MASTER", filename + ".none"}, 1, false},
+		{"missing key file", []string{"-keyfile", keyFile + ".none", filename}, 1, false},
+		{"good", []string{"-key", "CRYCOTEST_MASTER", filename}, 0, true},
+		{"good key file", []string{"-keyfile", keyFile, filename}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(filename, []byte(cfg), 0600); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout = os.Stdout, os.Stderr }()
+
+			if got := datakey(tt.args); got != tt.wantCode {
+				t.Errorf("datakey() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			data, _ := ioutil.ReadFile(filename)
+			if got := cryco.IsDataKeyHeader(string(data)); got != tt.wantHeader {
+				t.Errorf("datakey() header = %v, want %v", got, tt.wantHeader)
+			}
+			if !tt.wantHeader {
+				return
+			}
+			master, _ := cryco.NewKeyring(cryco.Key{Bytes: key})
+			dek, err := dataKeyFromFile(filename, master)
+			if err != nil {
+				t.Fatalf("dataKeyFromFile() error = %v", err)
+			}
+			lines := strings.Split(string(data), "\n")
+			got, err := cryco.Decrypt(dek, strings.TrimPrefix(lines[3], "B = "))
+			if err != nil || got != "secret" {
+				t.Errorf("datakey() value decrypts to %q %v", got, err)
+			}
+			if got := datakey(tt.args); got != 1 {
+				t.Errorf("datakey() on file with data key = %v, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mengstr/cryco"
+)
+
+// Key subcommands, invoked as cryco key <command> [flags] [args]
+var keyCommands = map[string]func(args []string) int{
+	"info": keyInfo,
+}
+
+func keyCmd(args []string) int {
+	if len(args) > 0 {
+		if cmd, ok := keyCommands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+	}
+	fmt.Fprintf(eout, "Usage: cryco key info [-key <env>] [-keyfile <path>] [value...]\n")
+	return 2
+}
+
+// Shows the fingerprint of the key and which key each of the values were sealed by
+func keyInfo(args []string) int {
+	flags := flag.NewFlagSet("key info", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	keyName := flags.String("key", "CRYCOKEY", "Show the key in env <string>")
+	keyFile := flags.String("keyfile", "", "Show the key in file <string> instead of an env")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco key info [-key <env>] [-keyfile <path>] [value...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var key []byte
+	var err error
+	if *keyFile != "" {
+		key, err = keyFromFile(*keyFile)
+	} else if os.Getenv(*keyName) != "" {
+		key, err = keyFromEnv(*keyName)
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	if len(key) == 0 && flags.NArg() == 0 {
+		fmt.Fprintf(eout, "No key found in env '%s'\n", *keyName)
+		return 1
+	}
+
+	if len(key) > 0 {
+		fmt.Fprintf(out, "key      %d bits, fingerprint %s\n", len(key)*8, cryco.KeyFingerprint(key))
+	}
+	for i, value := range flags.Args() {
+		fmt.Fprintf(out, "value %-2d %s\n", i+1, valueInfo(key, value))
+	}
+	return 0
+}
+
+// Describes the envelope of the value and if it was sealed by the key
+func valueInfo(key []byte, value string) string {
+	if !cryco.IsEnvelope(value) {
+		return "legacy value, no fingerprint recorded"
+	}
+	e, err := cryco.ParseEnvelope(value)
+	if err != nil {
+		return err.Error()
+	}
+	info := []string{e.Alg}
+	if e.KeyID != "" {
+		info = append(info, "key id "+e.KeyID)
+	}
+	if e.Fingerprint() == "" {
+		return strings.Join(append(info, "no fingerprint recorded"), ", ")
+	}
+	info = append(info, "fingerprint "+e.Fingerprint())
+	if len(key) > 0 {
+		fp := cryco.KeyFingerprint(key)
+		if e.Alg == cryco.AlgX25519 {
+			pub, _ := cryco.PublicKey(key)
+			fp = cryco.KeyFingerprint(pub)
+		}
+		if fp == e.Fingerprint() {
+			info = append(info, "sealed by the key")
+		} else {
+			info = append(info, "sealed by another key")
+		}
+	}
+	return strings.Join(info, ", ")
+}
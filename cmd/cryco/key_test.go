@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_keyInfo(t *testing.T) {
+	key, _ := cryco.GenerateKeySize(cryco.KeySize256)
+	other, _ := cryco.GenerateKeySize(cryco.KeySize128)
+	os.Setenv("CRYCOTEST_INFO", base64.URLEncoding.EncodeToString(key))
+	defer os.Unsetenv("CRYCOTEST_INFO")
+	fp := cryco.KeyFingerprint(key)
+	sealed, _ := cryco.EncryptWithOptions(key, "secret", cryco.Options{KeyID: "v2", Fingerprint: true})
+	sealedOther, _ := cryco.EncryptWithOptions(other, "secret", cryco.Options{Fingerprint: true})
+	plain, _ := cryco.Encrypt(key, "secret")
+	_, pub, _ := cryco.GenerateKeyPair()
+	sealedTo, _ := cryco.EncryptTo(pub, "secret", cryco.Options{Fingerprint: true})
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     []string
+	}{
+		{"no command", nil, 2, nil},
+		{"unknown command", []string{"show"}, 2, nil},
+		{"key", []string{"info", "-key", "CRYCOTEST_INFO"}, 0, []string{"key      256 bits, fingerprint " + fp}},
+		{"no key", []string{"info", "-key", "CRYCOTEST_NONE"}, 1, nil},
+		{"values", []string{"info", "-key", "CRYCOTEST_INFO", sealed, sealedOther, plain, "abc", sealedTo}, 0, []string{
+			"key      256 bits, fingerprint " + fp,
+			"value 1  aesgcm, key id v2, fingerprint " + fp + ", sealed by the key",
+			"value 2  aesgcm, fingerprint " + cryco.KeyFingerprint(other) + ", sealed by another key",
+			"value 3  aesgcm, no fingerprint recorded",
+			"value 4  legacy value, no fingerprint recorded",
+			"value 5  x25519, fingerprint " + cryco.KeyFingerprint(pub) + ", sealed by another key",
+		}},
+		{"values without key", []string{"info", "-key", "CRYCOTEST_NONE", sealed}, 0, []string{
+			"value 1  aesgcm, key id v2, fingerprint " + fp,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout = os.Stdout, os.Stderr }()
+
+			if got := keyCmd(tt.args); got != tt.wantCode {
+				t.Errorf("keyCmd() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			if got := strings.TrimSpace(stdout.String()); got != strings.Join(tt.want, "\n") {
+				t.Errorf("keyCmd() = %q, want %q", got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
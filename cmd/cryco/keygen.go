@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mengstr/cryco"
+	"github.com/mengstr/cryco/keyenc"
+)
+
+// Generates a symmetric key, or with -pair an X25519 key pair
+func keygen(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	pair := flags.Bool("pair", false, "Generate an X25519 key pair for encrypting to a public key")
+	keySize := flags.Int("size", 128, "Size in bits (128, 192 or 256) of the symmetric key")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco keygen [-pair] [-size <bits>]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return 2
+	}
+
+	if !*pair {
+		size, err := keyBytes(*keySize)
+		if err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			return 1
+		}
+		key, err := cryco.GenerateKeySize(size)
+		if err != nil {
+			fmt.Fprintf(eout, "Can't generate random key: %s\n", err)
+			return 1
+		}
+		fmt.Fprintln(out, keyenc.Encode(key))
+		return 0
+	}
+
+	priv, pub, err := cryco.GenerateKeyPair()
+	if err != nil {
+		fmt.Fprintf(eout, "Can't generate key pair: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "private %s\n", keyenc.Encode(priv))
+	fmt.Fprintf(out, "public  %s\n", keyenc.Encode(pub))
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_keygen(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantCode  int
+		wantLines int
+	}{
+		{"symmetric", []string{}, 0, 1},
+		{"symmetric 256", []string{"-size", "256"}, 0, 1},
+		{"bad size", []string{"-size", "100"}, 1, 0},
+		{"truncated size", []string{"-size", "130"}, 1, 0},
+		{"truncated size 255", []string{"-size", "255"}, 1, 0},
+		{"pair", []string{"-pair"}, 0, 2},
+		{"double dash pair", []string{"--pair"}, 0, 2},
+		{"extra args", []string{"-pair", "foo"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout = os.Stdout, os.Stderr }()
+
+			if got := keygen(tt.args); got != tt.wantCode {
+				t.Errorf("keygen() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if tt.wantLines == 0 {
+				if stdout.Len() != 0 {
+					t.Errorf("keygen() output %q", stdout.String())
+				}
+				return
+			}
+			if len(lines) != tt.wantLines {
+				t.Fatalf("keygen() output %q", stdout.String())
+			}
+			if tt.wantLines == 1 {
+				return
+			}
+			priv, err1 := base64.URLEncoding.DecodeString(strings.Fields(lines[0])[1])
+			pub, err2 := base64.URLEncoding.DecodeString(strings.Fields(lines[1])[1])
+			if err1 != nil || err2 != nil {
+				t.Fatalf("keygen() output %q", stdout.String())
+			}
+			sealed, _ := cryco.EncryptTo(pub, "secret", cryco.Options{})
+			if got, err := cryco.Decrypt(priv, sealed); err != nil || got != "secret" {
+				t.Errorf("keygen() pair decrypts to %q %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mengstr/cryco"
+)
+
+// Replaced by the tests to not actually listen
+var listenAndServe = http.ListenAndServe
+
+// Serves the reference key service, wrapping and unwrapping keys using the key in the env
+func kmsServe(args []string) int {
+	flags := flag.NewFlagSet("kms-serve", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	listen := flags.String("listen", "127.0.0.1:8200", "Listen on address <string>")
+	keyName := flags.String("key", "CRYCOKEY", "Wrap keys using the key in env <string>")
+	keyFile := flags.String("keyfile", "", "Wrap keys using the key in file <string> instead of an env")
+	keyID := flags.String("kid", "", "Record <string> as the key ID in the wrapped keys")
+	tokenName := flags.String("token", "", "Require the bearer token in env <string>")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco kms-serve [-listen <addr>] [-key <env> | -keyfile <path>] [-kid <id>] [-token <env>]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	kr, err := keyringFrom(*keyName, *keyFile, *keyID)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	token := ""
+	if *tokenName != "" {
+		if token = os.Getenv(*tokenName); token == "" {
+			fmt.Fprintf(eout, "Env '%s' dosen't exist or is empty\n", *tokenName)
+			return 1
+		}
+	}
+	fmt.Fprintf(eout, "Key service listening on %s\n", *listen)
+	if err := listenAndServe(*listen, cryco.KMSHandler(kr, token)); err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	return 0
+}
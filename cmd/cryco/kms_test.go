@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_kmsServe(t *testing.T) {
+	key, _ := cryco.GenerateKeySize(cryco.KeySize256)
+	os.Setenv("CRYCOTEST_KMS", base64.URLEncoding.EncodeToString(key))
+	os.Setenv("CRYCOTEST_TOKEN", "t0ken")
+	defer os.Unsetenv("CRYCOTEST_KMS")
+	defer os.Unsetenv("CRYCOTEST_TOKEN")
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := writeKeyFile(t, dir, "key", key)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantAddr string
+		token    string
+	}{
+		{"args", []string{"extra"}, 2, "", ""},
+		{"missing key", []string{"-key", "CRYCOTEST_NONE"}, 1, "", ""},
+		{"missing key file", []string{"-keyfile", keyFile + ".none"}, 1, "", ""},
+		{"missing token", []string{"-key", "CRYCOTEST_KMS", "-token", "CRYCOTEST_NONE"}, 1, "", ""},
+		{"good", []string{"-key", "CRYCOTEST_KMS", "-listen", "127.0.0.1:0"}, 1, "127.0.0.1:0", ""},
+		{"key file", []string{"-keyfile", keyFile}, 1, "127.0.0.1:8200", ""},
+		{"token", []string{"-key", "CRYCOTEST_KMS", "-token", "CRYCOTEST_TOKEN"}, 1, "127.0.0.1:8200", "t0ken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout = os.Stdout, os.Stderr }()
+			gotAddr := ""
+			listenAndServe = func(addr string, h http.Handler) error {
+				gotAddr = addr
+				srv := httptest.NewServer(h)
+				defer srv.Close()
+				client := &cryco.KMSClient{URL: srv.URL, Token: tt.token}
+				wrapped, err := client.Wrap(key)
+				if err != nil {
+					t.Errorf("Wrap() error = %v", err)
+				}
+				if got, err := client.Unwrap(wrapped); err != nil || !bytes.Equal(got, key) {
+					t.Errorf("Unwrap() = %v %v, want %v", got, err, key)
+				}
+				return errors.New("stopped")
+			}
+			defer func() { listenAndServe = http.ListenAndServe }()
+
+			if got := kmsServe(tt.args); got != tt.wantCode {
+				t.Errorf("kmsServe() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			if gotAddr != tt.wantAddr {
+				t.Errorf("kmsServe() listened on %v, want %v", gotAddr, tt.wantAddr)
+			}
+		})
+	}
+}
@@ -1,70 +1,132 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
+	"bufio"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-)
+	"strings"
+	"time"
 
-const (
-	keylen = 16
+	"github.com/mengstr/cryco"
+	"github.com/mengstr/cryco/keyenc"
 )
 
 var (
-	out  = os.Stdout
-	eout = os.Stderr
+	in   io.Reader = os.Stdin
+	out  io.Writer = os.Stdout
+	eout io.Writer = os.Stderr
 )
 
+// Subcommands, invoked as cryco <command> [flags] [args]
+var commands = map[string]func(args []string) int{
+	"combine":   combine,
+	"datakey":   datakey,
+	"key":       keyCmd,
+	"keygen":    keygen,
+	"kms-serve": kmsServe,
+	"rotate":    rotate,
+	"split":     split,
+}
+
 func main() {
-	var err error
-	key := make([]byte, keylen)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
 
 	genKey := flag.Bool("gen", false, "Generate key")
+	keySize := flag.Int("size", 128, "Size in bits (128, 192 or 256) of the key generated by -gen")
 	keyName := flag.String("key", "", "Use env <string> instead of 'CRYCOKEY' as the key")
+	keyFile := flag.String("keyfile", "", "Read the key from file <string>, e.g. /dev/fd/3 for an inherited descriptor")
+	keyID := flag.String("kid", "", "Record <string> as the key ID in the ciphertext envelope")
+	fingerprint := flag.Bool("fp", false, "Record the fingerprint of the key in the ciphertext envelope")
+	notBefore := flag.String("nbf", "", "Value not valid before <string>, a RFC 3339 time, a date or a duration from now like 1h")
+	notAfter := flag.String("exp", "", "Value expires at <string>, a RFC 3339 time, a date or a duration from now like 72h")
+	name := flag.String("aad", "", "Bind the value to the tag name <string> so it only decrypts for that name")
+	passName := flag.String("passphrase", "", "Derive the key from the passphrase in env <string>, or read from stdin if '-'")
+	salt := flag.String("salt", "", "Salt, at least 8 characters, used when deriving the key from a passphrase")
+	alg := flag.String("alg", cryco.AlgAESGCM, "Algorithm, '"+cryco.AlgAESGCM+"' or '"+cryco.AlgXChaCha20Poly1305+"' (needs a 256 bit key)")
+	dataKeyFile := flag.String("file", "", "Encrypt using the data key of the config file <string> instead of the key itself")
+	recipient := flag.String("to", "", "Encrypt to the X25519 public key <string> from 'cryco keygen -pair' instead of using a key")
 	flag.Parse()
 	plaintext := flag.Arg(0)
 
+	nbf, err := parseTime(*notBefore)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		os.Exit(1)
+	}
+	exp, err := parseTime(*notAfter)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		os.Exit(1)
+	}
+
 	if *genKey {
-		fmt.Fprintln(out, GenerateKey())
+		fmt.Fprintln(out, GenerateKey(*keySize))
 		os.Exit(0)
 
 	}
 
-	s := os.Getenv("CRYCOKEY")
-	if s != "" {
-		b, err := base64.URLEncoding.DecodeString(s)
+	if *recipient != "" {
+		pub, err := keyenc.Decode(*recipient)
 		if err != nil {
-			fmt.Fprintf(eout, "Can't decode CRYCOKEY from env: %s\n", err)
+			fmt.Fprintf(eout, "Can't decode public key: %s\n", err)
 			os.Exit(1)
 		}
-		if len(b) != keylen {
-			fmt.Fprintf(eout, "Decoded CRYCOKEY is not 16 bytes\n")
+		if plaintext == "" {
+			fmt.Fprintf(eout, "No plaintext specified\n")
 			os.Exit(1)
 		}
-		key = b
+		cipherB64, err := cryco.EncryptTo(pub, plaintext, cryco.Options{KeyID: *keyID, Name: *name, Fingerprint: *fingerprint, NotBefore: nbf, NotAfter: exp})
+		if err != nil {
+			fmt.Fprintf(eout, "Error encrypting plaintext: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(out, cipherB64)
+		os.Exit(0)
 	}
 
-	s = os.Getenv(*keyName)
-	if *keyName != "" && s == "" {
+	key, err := keyFromEnv("CRYCOKEY")
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		os.Exit(1)
+	}
+
+	if *keyName != "" && os.Getenv(*keyName) == "" {
 		fmt.Fprintf(eout, "Env '%s' dosen't exist or is empty\n", *keyName)
 		os.Exit(1)
 	}
-	if s != "" {
-		b, err := base64.URLEncoding.DecodeString(s)
+	if *keyName != "" {
+		if key, err = keyFromEnv(*keyName); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *keyFile != "" {
+		if key, err = keyFromFile(*keyFile); err != nil {
+			fmt.Fprintf(eout, "%s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var kdf *cryco.KDFParams
+	if *passName != "" {
+		passphrase, err := readPassphrase(*passName)
 		if err != nil {
-			fmt.Fprintf(eout, "Can't decode key from env '%s': %s\n", s, err)
+			fmt.Fprintf(eout, "%s\n", err)
 			os.Exit(1)
 		}
-		if len(b) != keylen {
-			fmt.Fprintf(eout, "Decoded env '%s' is not 16 bytes\n", *keyName)
+		params := cryco.DefaultKDFParams([]byte(*salt))
+		if key, err = cryco.DeriveKey(passphrase, params); err != nil {
+			fmt.Fprintf(eout, "Can't derive key from passphrase: %s\n", err)
 			os.Exit(1)
 		}
-		key = b
+		kdf = &params
 	}
 
 	if allZero(key) {
@@ -77,37 +139,118 @@ func main() {
 		os.Exit(1)
 	}
 
-	cipherBlock, err := aes.NewCipher(key)
+	if *dataKeyFile != "" {
+		master, err := cryco.NewKeyring(cryco.Key{Bytes: key})
+		if err == nil {
+			key, err = dataKeyFromFile(*dataKeyFile, master)
+		}
+		if err != nil {
+			fmt.Fprintf(eout, "Can't get data key: %s\n", err)
+			os.Exit(1)
+		}
+		*keyID = cryco.DataKeyID
+		kdf = nil
+	}
+
+	cipherB64, err := cryco.EncryptWithOptions(key, plaintext, cryco.Options{Alg: *alg, KeyID: *keyID, Name: *name, KDF: kdf, Fingerprint: *fingerprint,
+		NotBefore: nbf, NotAfter: exp})
 	if err != nil {
-		fmt.Fprintf(eout, "Error initializing cipher(1)\n")
+		fmt.Fprintf(eout, "Error encrypting plaintext: %s\n", err)
 		os.Exit(1)
 	}
+	fmt.Fprintln(out, cipherB64)
+}
 
-	aead, err := cipher.NewGCM(cipherBlock)
+// Returns the key decoded from the environment variable, or nil if it isn't set
+func keyFromEnv(name string) ([]byte, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil, nil
+	}
+	b, err := keyenc.Decode(s)
 	if err != nil {
-		fmt.Fprintf(eout, "Error initializing cipher(2)\n")
-		os.Exit(1)
+		return nil, fmt.Errorf("Can't decode key from env '%s': %s", name, err)
 	}
+	if !cryco.ValidKeySize(len(b)) {
+		return nil, fmt.Errorf("Decoded env '%s' is not 16, 24 or 32 bytes", name)
+	}
+	return b, nil
+}
 
-	nonce := make([]byte, aead.NonceSize())
-	_, err = io.ReadFull(rand.Reader, nonce)
+// Returns the key read from the file, refusing files others than the owner and group have access to
+func keyFromFile(path string) ([]byte, error) {
+	f, err := cryco.OpenKeyFile(path)
 	if err != nil {
-		fmt.Fprintf(eout, "Error initializing cipher(3)\n")
-		os.Exit(1)
+		return nil, fmt.Errorf("Can't read key file: %s", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read key file '%s': %s", path, err)
+	}
+	b, err := keyenc.Decode(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Can't decode key from file '%s': %s", path, err)
+	}
+	if !cryco.ValidKeySize(len(b)) {
+		return nil, fmt.Errorf("Decoded key file '%s' is not 16, 24 or 32 bytes", path)
+	}
+	return b, nil
+}
+
+// Returns the time given as a RFC 3339 time, a date or a duration from now, or the zero time if empty
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("Can't parse time '%s', use a RFC 3339 time, a date or a duration", s)
+}
 
-	fmt.Fprintln(out, base64.URLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil)))
+// Returns the passphrase from the environment variable, or the first line of stdin if name is "-"
+func readPassphrase(name string) (string, error) {
+	if name != "-" {
+		s := os.Getenv(name)
+		if s == "" {
+			return "", fmt.Errorf("Env '%s' dosen't exist or is empty", name)
+		}
+		return s, nil
+	}
+	s, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("Can't read passphrase: %s", err)
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// Returns the key size in bytes for a size in bits, which must be 128, 192 or 256
+func keyBytes(bits int) (int, error) {
+	if bits != 128 && bits != 192 && bits != 256 {
+		return 0, fmt.Errorf("Key size must be 128, 192 or 256 bits, not %d", bits)
+	}
+	return bits / 8, nil
 }
 
-// GenerateKey ..
-func GenerateKey() string {
-	key := make([]byte, keylen)
-	_, err := rand.Read(key)
+// GenerateKey returns a new random key of the given size in bits encoded as Base64
+func GenerateKey(bits int) string {
+	size, err := keyBytes(bits)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		os.Exit(1)
+	}
+	key, err := cryco.GenerateKeySize(size)
 	if err != nil {
 		fmt.Fprintf(eout, "Can't generate random key: %s\n", err)
 		os.Exit(1)
 	}
-	return base64.URLEncoding.EncodeToString(key)
+	return keyenc.Encode(key)
 }
 
 // Check if a []byte are all zeros
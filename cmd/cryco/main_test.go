@@ -1,7 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func Test_allZero(t *testing.T) {
@@ -45,11 +52,158 @@ func Test_main(t *testing.T) {
 
 func Test_generateKey(t *testing.T) {
 	t.Run("CheckNotSame", func(t *testing.T) {
-		got1 := GenerateKey()
-		got2 := GenerateKey()
-		got3 := GenerateKey()
+		got1 := GenerateKey(128)
+		got2 := GenerateKey(128)
+		got3 := GenerateKey(128)
 		if got1 == got2 || got1 == got3 || got2 == got3 {
 			t.Errorf("GenerateKey() generates same keys")
 		}
 	})
+	for _, bits := range []int{128, 192, 256} {
+		t.Run(fmt.Sprintf("Size%d", bits), func(t *testing.T) {
+			b, err := base64.URLEncoding.DecodeString(GenerateKey(bits))
+			if err != nil || len(b)*8 != bits {
+				t.Errorf("GenerateKey(%d) = %d bytes, %v", bits, len(b), err)
+			}
+		})
+	}
+}
+
+func Test_keyBytes(t *testing.T) {
+	tests := []struct {
+		bits    int
+		want    int
+		wantErr bool
+	}{
+		{128, 16, false},
+		{192, 24, false},
+		{256, 32, false},
+		{0, 0, true},
+		{130, 0, true},
+		{255, 0, true},
+		{512, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.bits), func(t *testing.T) {
+			got, err := keyBytes(tt.bits)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("keyBytes() = %v %v, want %v wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_keyFromFile(t *testing.T) {
+	key := GenerateKey(256)
+	want, _ := base64.URLEncoding.DecodeString(key)
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "key")
+
+	tests := []struct {
+		name    string
+		content string
+		perm    os.FileMode
+		want    []byte
+		wantErr bool
+	}{
+		{"good", key + "\n", 0600, want, false},
+		{"group readable", key, 0640, want, false},
+		{"world readable", key, 0644, nil, true},
+		{"bad base64", "#" + key, 0600, nil, true},
+		{"bad size", base64.URLEncoding.EncodeToString([]byte("short")), 0600, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filename)
+			if err := ioutil.WriteFile(filename, []byte(tt.content), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			os.Chmod(filename, tt.perm)
+			got, err := keyFromFile(filename)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyFromFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("keyFromFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_keyFromEnv(t *testing.T) {
+	key := []byte{0xfb, 0xff, 0xbf, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 0xfe}
+	tests := []struct {
+		name    string
+		value   string
+		want    []byte
+		wantErr bool
+	}{
+		{"unset", "", nil, false},
+		{"url", base64.URLEncoding.EncodeToString(key), key, false},
+		{"std", base64.StdEncoding.EncodeToString(key), key, false},
+		{"raw url", base64.RawURLEncoding.EncodeToString(key), key, false},
+		{"hex", fmt.Sprintf("%x", key), key, false},
+		{"bad", "not a key!", nil, true},
+		{"bad size", base64.StdEncoding.EncodeToString(key[:10]), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("CRYCOTEST_ENC", tt.value)
+			defer os.Unsetenv("CRYCOTEST_ENC")
+			got, err := keyFromEnv("CRYCOTEST_ENC")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("keyFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"empty", "", time.Time{}, false},
+		{"rfc3339", "2030-01-02T03:04:05Z", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"date", "2030-01-02", time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{"bad", "tomorrow", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTime() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	t.Run("duration", func(t *testing.T) {
+		got, err := parseTime("72h")
+		if d := time.Until(got); err != nil || d < 71*time.Hour || d > 72*time.Hour {
+			t.Errorf("parseTime() = %v %v, want 72h from now", got, err)
+		}
+	})
+}
+
+// Writes the key to a file only the owner can read and returns its name
+func writeKeyFile(t *testing.T, dir string, name string, key []byte) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(base64.URLEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mengstr/cryco"
+)
+
+// Re-encrypts all values in the config files from the old key to the new key
+func rotate(args []string) int {
+	flags := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	oldName := flags.String("old", "CRYCOKEY", "Use env <string> as the old key")
+	oldFile := flags.String("oldfile", "", "Read the old key from file <string> instead of an env")
+	newName := flags.String("new", "", "Use env <string> as the new key")
+	newFile := flags.String("newfile", "", "Read the new key from file <string> instead of an env")
+	keyID := flags.String("kid", "", "Record <string> as the key ID in the new ciphertext envelopes")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco rotate -new <env> | -newfile <path> [-old <env> | -oldfile <path>] [-kid <id>] file...\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || (*newName == "" && *newFile == "") {
+		flags.Usage()
+		return 2
+	}
+
+	oldKeys, err := keyringFrom(*oldName, *oldFile, "")
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	newKeys, err := keyringFrom(*newName, *newFile, *keyID)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+
+	for _, filename := range flags.Args() {
+		cnt, err := rotateFile(filename, oldKeys, newKeys)
+		if err != nil {
+			fmt.Fprintf(eout, "%s: %s\n", filename, err)
+			return 1
+		}
+		fmt.Fprintf(out, "%s: %d values rotated\n", filename, cnt)
+	}
+	return 0
+}
+
+// Returns a keyring holding the key from the file if one is given, else from the environment variable
+func keyringFrom(name string, file string, keyID string) (*cryco.Keyring, error) {
+	key, err := keyFrom(name, file)
+	if err != nil {
+		return nil, err
+	}
+	return cryco.NewKeyring(cryco.Key{ID: keyID, Bytes: key})
+}
+
+// Returns the key from the file if one is given, else from the environment variable
+func keyFrom(name string, file string) ([]byte, error) {
+	if file != "" {
+		return keyFromFile(file)
+	}
+	key, err := keyFromEnv(name)
+	if err != nil {
+		return nil, err
+	}
+	if allZero(key) {
+		return nil, fmt.Errorf("No key found in env '%s'", name)
+	}
+	return key, nil
+}
+
+// Rotates the values in the file and atomically replaces it with the result
+func rotateFile(filename string, oldKeys *cryco.Keyring, newKeys *cryco.Keyring) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	cnt, err := cryco.Rotate(&buf, f, oldKeys, newKeys)
+	if err != nil {
+		return 0, err
+	}
+	return cnt, writeFileAtomic(filename, buf.Bytes(), fi.Mode().Perm())
+}
+
+// Writes the data to a temporary file next to filename and renames it over
+// filename, so readers see either the old or the new content but never a mix
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_rotate(t *testing.T) {
+	oldKey, _ := cryco.GenerateKeySize(cryco.KeySize128)
+	newKey, _ := cryco.GenerateKeySize(cryco.KeySize256)
+	os.Setenv("CRYCOTEST_OLD", base64.URLEncoding.EncodeToString(oldKey))
+	os.Setenv("CRYCOTEST_NEW", base64.URLEncoding.EncodeToString(newKey))
+	defer os.Unsetenv("CRYCOTEST_OLD")
+	defer os.Unsetenv("CRYCOTEST_NEW")
+
+	sealed, _ := cryco.Encrypt(oldKey, "secret")
+	cfg := "# Comment\n\nA = (clear)\nB = " + sealed + "\n"
+
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.cfg")
+	keyDir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keyDir)
+	oldFile := writeKeyFile(t, keyDir, "old", oldKey)
+	newFile := writeKeyFile(t, keyDir, "new", newKey)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantKey  []byte
+	}{
+		{"no args", []string{}, 2, oldKey},
+		{"no new key", []string{"-old", "CRYCOTEST_OLD", filename}, 2, oldKey},
+		{"missing new key", []string{"-old", "CRYCOTEST_OLD", "-new", "CRYCOTEST_NONE", filename}, 1, oldKey},
+		{"wrong old key", []string{"-old", "CRYCOTEST_NEW", "-new", "CRYCOTEST_NEW", filename}, 1, oldKey},
+		{"missing file", []string{"-old", "CRYCOTEST_OLD", "-new", "CRYCOTEST_NEW", filename + ".none"}, 1, oldKey},
+		{"missing new key file", []string{"-old", "CRYCOTEST_OLD", "-newfile", newFile + ".none", filename}, 1, oldKey},
+		{"good", []string{"-old", "CRYCOTEST_OLD", "-new", "CRYCOTEST_NEW", "-kid", "v2", filename}, 0, newKey},
+		{"good files", []string{"-oldfile", oldFile, "-newfile", newFile, filename}, 0, newKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(filename, []byte(cfg), 0640); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout = os.Stdout, os.Stderr }()
+
+			if got := rotate(tt.args); got != tt.wantCode {
+				t.Errorf("rotate() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(data), "\n")
+			if len(lines) != 5 || lines[0] != "# Comment" || lines[1] != "" || lines[2] != "A = (clear)" {
+				t.Errorf("rotate() changed the file into %q", data)
+			}
+			got, err := cryco.Decrypt(tt.wantKey, strings.TrimPrefix(lines[3], "B = "))
+			if err != nil || got != "secret" {
+				t.Errorf("rotate() value decrypts to %q %v", got, err)
+			}
+			fi, err := os.Stat(filename)
+			if err != nil || fi.Mode().Perm() != 0640 {
+				t.Errorf("rotate() changed file mode %v %v", fi.Mode(), err)
+			}
+			files, _ := ioutil.ReadDir(dir)
+			if len(files) != 1 {
+				t.Errorf("rotate() left %d files behind", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mengstr/cryco"
+	"github.com/mengstr/cryco/keyenc"
+)
+
+// Splits the key in the env into n shares of which any k recreates it
+func split(args []string) int {
+	flags := flag.NewFlagSet("split", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	n := flags.Int("n", 5, "Number of shares to create")
+	k := flags.Int("k", 3, "Number of shares needed to recreate the key")
+	keyName := flags.String("key", "CRYCOKEY", "Split the key in env <string>")
+	keyFile := flags.String("keyfile", "", "Split the key in file <string> instead of an env")
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco split [-n <shares>] [-k <needed>] [-key <env> | -keyfile <path>]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	key, err := keyFrom(*keyName, *keyFile)
+	if err != nil {
+		fmt.Fprintf(eout, "%s\n", err)
+		return 1
+	}
+	shares, err := cryco.SplitKey(key, *n, *k)
+	if err != nil {
+		fmt.Fprintf(eout, "Can't split key: %s\n", err)
+		return 1
+	}
+	for _, share := range shares {
+		fmt.Fprintln(out, share)
+	}
+	return 0
+}
+
+// Recreates the key from the shares given as arguments, or one per line on stdin
+func combine(args []string) int {
+	flags := flag.NewFlagSet("combine", flag.ContinueOnError)
+	flags.SetOutput(eout)
+	flags.Usage = func() {
+		fmt.Fprintf(eout, "Usage: cryco combine [share...]\n")
+		fmt.Fprintf(eout, "Without arguments the shares are read from stdin, one per line\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	shares := flags.Args()
+	if len(shares) == 0 {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			if s := strings.TrimSpace(scanner.Text()); s != "" {
+				shares = append(shares, s)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(eout, "Can't read shares: %s\n", err)
+			return 1
+		}
+	}
+	key, err := cryco.CombineShares(shares)
+	if err == nil && !cryco.ValidKeySize(len(key)) {
+		err = fmt.Errorf("%w %d", cryco.ErrKeySize, len(key))
+	}
+	if err != nil {
+		fmt.Fprintf(eout, "Can't combine shares: %s\n", err)
+		return 1
+	}
+	fmt.Fprintln(out, keyenc.Encode(key))
+	return 0
+}
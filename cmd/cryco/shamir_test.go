@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mengstr/cryco"
+)
+
+func Test_splitCombine(t *testing.T) {
+	key, _ := cryco.GenerateKeySize(cryco.KeySize256)
+	keyB64 := base64.URLEncoding.EncodeToString(key)
+	os.Setenv("CRYCOTEST_SPLIT", keyB64)
+	defer os.Unsetenv("CRYCOTEST_SPLIT")
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := writeKeyFile(t, dir, "key", key)
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantCode  int
+		wantLines int
+	}{
+		{"default", []string{"-key", "CRYCOTEST_SPLIT"}, 0, 5},
+		{"2 of 3", []string{"-key", "CRYCOTEST_SPLIT", "-n", "3", "-k", "2"}, 0, 3},
+		{"bad k", []string{"-key", "CRYCOTEST_SPLIT", "-n", "3", "-k", "4"}, 1, 0},
+		{"key file", []string{"-keyfile", keyFile}, 0, 5},
+		{"missing key", []string{"-key", "CRYCOTEST_NONE"}, 1, 0},
+		{"missing key file", []string{"-keyfile", keyFile + ".none"}, 1, 0},
+		{"args", []string{"-key", "CRYCOTEST_SPLIT", "extra"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			out, eout = &stdout, &stderr
+			defer func() { out, eout, in = os.Stdout, os.Stderr, os.Stdin }()
+
+			if got := split(tt.args); got != tt.wantCode {
+				t.Errorf("split() = %v, want %v (%s)", got, tt.wantCode, stderr.String())
+			}
+			shares := strings.Fields(stdout.String())
+			if len(shares) != tt.wantLines {
+				t.Fatalf("split() = %d shares, want %d", len(shares), tt.wantLines)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+
+			// The first two shares as arguments, all of them on stdin
+			stdout.Reset()
+			if got := combine(shares[:2]); len(shares) == 3 && (got != 0 || strings.TrimSpace(stdout.String()) != keyB64) {
+				t.Errorf("combine() = %v %q, want %v", got, stdout.String(), keyB64)
+			}
+			stdout.Reset()
+			in = strings.NewReader(strings.Join(shares, "\n") + "\n\n")
+			if got := combine(nil); got != 0 || strings.TrimSpace(stdout.String()) != keyB64 {
+				t.Errorf("combine() = %v %q, want %v", got, stdout.String(), keyB64)
+			}
+			if got := combine(shares[:1]); got != 1 {
+				t.Errorf("combine() of one share = %v, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package cryco
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Credentials are files managed by the service manager or container runtime,
+// systemd puts the files given by LoadCredential= in $CREDENTIALS_DIRECTORY
+// and Docker puts secrets in /run/secrets. A credential can hold the keys,
+// see CredentialProvider, or the value of a field tagged with cred. Since the
+// platform controls these directories their file permissions aren't checked.
+
+// Directory where Docker mounts secrets, a variable so tests can move it
+var secretsDir = "/run/secrets"
+
+// Returns the path of the credential, looking first in $CREDENTIALS_DIRECTORY and
+// then in the Docker secrets directory. Returns false if there is no such credential.
+func credentialPath(name string) (string, bool, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", false, fmt.Errorf("%w, bad credential name '%s'", ErrParse, name)
+	}
+	for _, dir := range []string{os.Getenv("CREDENTIALS_DIRECTORY"), secretsDir} {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Returns the content of the credential with trailing newlines removed, false if there
+// is no such credential
+func readCredential(name string) (string, bool, error) {
+	path, ok, err := credentialPath(name)
+	if !ok {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// CredentialProvider reads the keys from the credential Name, a list of keys separated by
+// commas or newlines as in FileProvider. An empty Name means KEY<executable name>.
+type CredentialProvider struct {
+	Name string
+}
+
+// Keys returns the keys read from the credential, or no keys if there is no such credential
+func (p CredentialProvider) Keys() ([]Key, error) {
+	name := p.Name
+	if name == "" {
+		exe, err := exeName()
+		if err != nil {
+			return nil, err
+		}
+		name = "KEY" + exe
+	}
+	path, ok, err := credentialPath(name)
+	if !ok {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	defer f.Close()
+	return readKeys(f)
+}
+
+// Sets the fields tagged with cred from credential files. The credential holds either an
+// encrypted value or the value itself, unlike in the config files cleartext values don't
+// need to be in paranthesis. Only enveloped ciphertexts are decrypted since credentials are
+// newer than the legacy ciphertexts, bound values are bound to the credential name. Fields
+// without a credential are left unchanged.
+func setFromCredentials(p interface{}, kr *Keyring) error {
+	var err error
+
+	if err = CheckParam(p); err != nil {
+		return err
+	}
+	e := reflect.ValueOf(p).Elem()
+	for i := 0; i < e.NumField(); i++ {
+		fld := e.Type().Field(i)
+		name, ok := fld.Tag.Lookup(tagCredVal)
+		if !ok {
+			if sub := nestedStruct(e, i); sub != nil {
+				if err = setFromCredentials(sub, kr); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		value, ok, err := readCredential(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if IsEnvelope(value) || isCleartext(value) {
+			if value, err = kr.DecryptWithName(value, name); err != nil {
+				return fmt.Errorf("%w in credential '%s'", err, name)
+			}
+		}
+		if err = setFieldValue(p, fld.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Creates a systemd credentials directory and a Docker secrets directory holding the files
+func credentialDirs(t *testing.T, creds map[string]string, secrets map[string]string) func() {
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sub, files := range map[string]map[string]string{"creds": creds, "secrets": secrets} {
+		os.Mkdir(filepath.Join(dir, sub), 0700)
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, sub, name), []byte(content), 0400); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	os.Setenv("CREDENTIALS_DIRECTORY", filepath.Join(dir, "creds"))
+	oldSecretsDir := secretsDir
+	secretsDir = filepath.Join(dir, "secrets")
+	return func() {
+		secretsDir = oldSecretsDir
+		os.Unsetenv("CREDENTIALS_DIRECTORY")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCredentialProvider(t *testing.T) {
+	defer credentialDirs(t,
+		map[string]string{"appkey": "new:" + key256B64 + "\nold:" + keyGoodB64 + "\n", "both": keyGoodB64, "bad": keyBadB64},
+		map[string]string{"dockerkey": key192B64 + "\n", "both": key256B64},
+	)()
+
+	tests := []struct {
+		name        string
+		cred        string
+		want        []Key
+		wantErr     bool
+		wantErrType error
+	}{
+		{"systemd", "appkey", []Key{{ID: "new", Bytes: bKey256}, {ID: "old", Bytes: bKeyGood}}, false, nil},
+		{"docker", "dockerkey", []Key{{ID: "", Bytes: bKey192}}, false, nil},
+		{"systemd first", "both", []Key{{ID: "", Bytes: bKeyGood}}, false, nil},
+		{"missing", "nokey", nil, false, nil},
+		{"bad key", "bad", nil, true, ErrBase64},
+		{"bad name", "../creds/appkey", nil, true, ErrParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CredentialProvider{Name: tt.cred}.Keys()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Keys() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReadersCredentials(t *testing.T) {
+	type testStruct struct {
+		I int64   `def:"(1)" fil:"I" cred:"app_i" env:"EnvI"`
+		F float64 `def:"(1.1)" fil:"F" cred:"app_f"`
+		S string  `fil:"S" cred:"app_s"`
+	}
+	kr, _ := NewKeyring(Key{ID: "test", Bytes: bKey256})
+	sealedS, _ := kr.EncryptWithOptions("sealed", Options{Name: "app_s"})
+	sealedWrongName, _ := kr.EncryptWithOptions("sealed", Options{Name: "S"})
+	cfg := "I = (2)\nF = (2.2)\nS = (file)\n"
+
+	tests := []struct {
+		name        string
+		creds       map[string]string
+		envI        string
+		want        testStruct
+		wantErr     bool
+		wantErrType error
+	}{
+		{"no credentials", nil, "", testStruct{2, 2.2, "file"}, false, nil},
+		{"plain", map[string]string{"app_i": "3\n", "app_s": "plain text"}, "", testStruct{3, 2.2, "plain text"}, false, nil},
+		{"plain Base64", map[string]string{"app_s": "aHVudGVyMg=="}, "", testStruct{2, 2.2, "aHVudGVyMg=="}, false, nil},
+		{"cleartext", map[string]string{"app_f": "(3.3)"}, "", testStruct{2, 3.3, "file"}, false, nil},
+		{"encrypted", map[string]string{"app_s": sealedS + "\n"}, "", testStruct{2, 2.2, "sealed"}, false, nil},
+		{"env wins", map[string]string{"app_i": "3"}, "(4)", testStruct{4, 2.2, "file"}, false, nil},
+		{"wrong name", map[string]string{"app_s": sealedWrongName}, "", testStruct{}, true, ErrInvalidKey},
+		{"bad value", map[string]string{"app_i": "three"}, "", testStruct{}, true, ErrParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer credentialDirs(t, tt.creds, nil)()
+			os.Unsetenv("EnvI")
+			if tt.envI != "" {
+				os.Setenv("EnvI", tt.envI)
+				defer os.Unsetenv("EnvI")
+			}
+			var got testStruct
+			err := kr.ParseReaders(&got, []io.Reader{strings.NewReader(cfg)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReaders() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("ParseReaders() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseReaders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
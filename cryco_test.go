@@ -15,6 +15,9 @@ const (
 	keyGoodB64   = "QWFhYWFhYWFhYWFhYWFhQQ=="                         // AaaaaaaaaaaaaaaA
 	keyWrongB64  = "WGFhYWFhYWFhYWFhYWFhWA=="                         // XaaaaaaaaaaaaaaX
 	keyBadB64    = "WFhYWFhYWFhYWFhYWFhQQ=="                          // Too short key
+	key192B64    = "QWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFB"                 // AaaaaaaaaaaaaaaaaaaaaaaA
+	key256B64    = "QWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYUE="     // AaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaA
+	key20B64     = "QWFhYWFhYWFhYWFhYWFhYWFhYUE="                     // AaaaaaaaaaaaaaaaaaaA
 	goodBase64   = "R29vZA=="                                         // Good as BASE64
 	badBase64    = "R29!ZA=="                                         // invalid character in BASE64
 	shortCipher  = "QUJDMTIz"                                         // ABC123 as BASE64
@@ -35,6 +38,8 @@ var (
 	bKeyShort = []byte{65, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97}
 	bKeyGood  = []byte{65, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 65}
 	bKeyWrong = []byte{111, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 97, 111}
+	bKey192   = []byte("AaaaaaaaaaaaaaaaaaaaaaaA")
+	bKey256   = []byte("AaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaA")
 )
 
 func Test_exeName(t *testing.T) {
@@ -70,6 +75,9 @@ func TestGetKey(t *testing.T) {
 		{"nothing", "", bKeyZero, false, nil},
 		{"bad env key", keyBadB64, bKeyZero, true, ErrBase64},
 		{"good env key", keyGoodB64, bKeyGood, false, nil},
+		{"good 192 env key", key192B64, bKey192, false, nil},
+		{"good 256 env key", key256B64, bKey256, false, nil},
+		{"odd size env key", key20B64, bKeyZero, true, ErrBase64},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -130,12 +138,117 @@ func TestDecrypt(t *testing.T) {
 	}
 }
 
+func TestEncrypt(t *testing.T) {
+	type args struct {
+		bKey      []byte
+		plaintext string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantErr     bool
+		wantErrType error
+	}{
+		{"short key", args{bKey: bKeyShort, plaintext: "ABC123"}, true, ErrInternal},
+		{"empty plaintext", args{bKey: bKeyGood, plaintext: ""}, false, nil},
+		{"good plaintext", args{bKey: bKeyGood, plaintext: "ABC123"}, false, nil},
+		{"paranthesis plaintext", args{bKey: bKeyGood, plaintext: "(ABC123)"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encrypt(tt.args.bKey, tt.args.plaintext)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Encrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Encrypt() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			again, _ := Encrypt(tt.args.bKey, tt.args.plaintext)
+			if got == again {
+				t.Errorf("Encrypt() generates same ciphertext twice")
+			}
+			plain, err := Decrypt(tt.args.bKey, got)
+			if err != nil || plain != tt.args.plaintext {
+				t.Errorf("Decrypt(Encrypt()) = %v %v, want %v", plain, err, tt.args.plaintext)
+			}
+			if _, err := Decrypt(bKeyWrong, got); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Decrypt(Encrypt()) with wrong key error = '%v', wantErr '%v'", err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	got1, err1 := GenerateKey()
+	got2, err2 := GenerateKey()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("GenerateKey() error = %v %v", err1, err2)
+	}
+	if len(got1) != KeySize128 || reflect.DeepEqual(got1, got2) {
+		t.Errorf("GenerateKey() = %v %v", got1, got2)
+	}
+}
+
+func TestGenerateKeySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{"zero", 0, true},
+		{"15", 15, true},
+		{"128", KeySize128, false},
+		{"192", KeySize192, false},
+		{"256", KeySize256, false},
+		{"64", 64, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateKeySize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GenerateKeySize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrKeySize) {
+					t.Errorf("GenerateKeySize() error = '%v', wantErr '%v'", err, ErrKeySize)
+				}
+				return
+			}
+			if len(got) != tt.size {
+				t.Errorf("GenerateKeySize() len = %v, want %v", len(got), tt.size)
+			}
+			cipherB64, err := Encrypt(got, "ABC123")
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if plain, err := Decrypt(got, cipherB64); err != nil || plain != "ABC123" {
+				t.Errorf("Decrypt(Encrypt()) = %v %v", plain, err)
+			}
+		})
+	}
+}
+
+func TestCleartext(t *testing.T) {
+	for _, s := range []string{"", "ABC123", "(ABC123)", "a = b"} {
+		got, err := Decrypt(bKeyGood, Cleartext(s))
+		if err != nil || got != s {
+			t.Errorf("Decrypt(Cleartext(%q)) = %q %v", s, got, err)
+		}
+	}
+}
+
 func Test_setValue(t *testing.T) {
 	type testStruct struct {
-		I  int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`     // 1
-		i2 int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`     // 1
-		F  float64 `default:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew=="` // 1.1
-		S  string  `default:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg=="` // One
+		I  int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`     // 1
+		i2 int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`     // 1
+		F  float64 `def:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew=="` // 1.1
+		S  string  `def:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg=="` // One
+		B  bool
 	}
 	var st testStruct
 
@@ -154,11 +267,13 @@ func Test_setValue(t *testing.T) {
 		{"Not exported int64", args{&st, "i2", "2"}, true, ErrNotExported},
 		{"Float64", args{&st, "F", "2.2"}, false, nil},
 		{"String", args{&st, "S", "Two"}, false, nil},
+		{"Bool", args{&st, "B", "true"}, false, nil},
+		{"Bad bool", args{&st, "B", "yes"}, true, ErrParse},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			st = testStruct{}
-			err := setValue(tt.args.p, tt.args.field, tt.args.value)
+			err := setFieldValue(tt.args.p, tt.args.field, tt.args.value)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("setValue() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -173,9 +288,9 @@ func Test_setValue(t *testing.T) {
 	t.Run("setValue() results", func(t *testing.T) {
 		st = testStruct{}
 		for _, tt := range tests {
-			_ = setValue(tt.args.p, tt.args.field, tt.args.value)
+			_ = setFieldValue(tt.args.p, tt.args.field, tt.args.value)
 		}
-		want := testStruct{2, 0, 2.2, "Two"}
+		want := testStruct{2, 0, 2.2, "Two", true}
 		if st != want {
 			t.Errorf("setValue() got %v, want %v", st, want)
 			return
@@ -185,16 +300,16 @@ func Test_setValue(t *testing.T) {
 
 func TestSetDefaults(t *testing.T) {
 	type testBadStruct struct {
-		I  int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
-		i2 int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`                // 1
-		F  float64 `default:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
-		S  string  `default:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
+		I  int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
+		i2 int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4="`                // 1
+		F  float64 `def:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
+		S  string  `def:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
 	}
 	type testGoodStruct struct {
-		I  int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
-		i2 int64   `other:"Foobar"`                                                    //
-		F  float64 `default:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
-		S  string  `default:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
+		I  int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
+		i2 int64   `other:"Foobar"`                                                //
+		F  float64 `def:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
+		S  string  `def:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
 	}
 	var stBad testBadStruct
 	var stGood testGoodStruct
@@ -250,18 +365,18 @@ const cfgOk3 = `
 #
 # Hello world
 
-I=3
-S=Three
-F=3.3
+I=(3)
+S=(Three)
+F=(3.3)
 `
 
 const cfgOk4 = `
 #
 # Hello world
 
-I=4
-S=Four
-F=4.4
+I=(4)
+S=(Four)
+F=(4.4)
 `
 
 const cfgEmpty = `
@@ -269,7 +384,6 @@ const cfgEmpty = `
 # Hello world
 `
 
-//
 func setEnvs(envs string) {
 	os.Unsetenv("EnvI")
 	os.Unsetenv("EnvF")
@@ -297,18 +411,18 @@ func resetReaders(rdrs0 *[]io.Reader, rdrs3 *[]io.Reader, rdrs4 *[]io.Reader) {
 	#
 	# Hello world
 	
-	I=3
-	S=Three
-	F=3.3
+	I=(3)
+	S=(Three)
+	F=(3.3)
 	`
 
 	const cfgOk4 = `
 	#
 	# Hello world
 	
-	I=4
-	S=Four
-	F=4.4
+	I=(4)
+	S=(Four)
+	F=(4.4)
 	`
 
 	const cfgEmpty = `
@@ -330,10 +444,10 @@ func TestParseReaders(t *testing.T) {
 	var rdrs3 []io.Reader
 	var rdrs4 []io.Reader
 	type testGoodStruct struct {
-		I  int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
-		i2 int64   `other:"Foobar"`                                                    //
-		F  float64 `default:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
-		S  string  `default:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
+		I  int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" fil:"I" env:"EnvI"`     // 1
+		i2 int64   `other:"Foobar"`                                                        //
+		F  float64 `def:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" fil:"F" env:"EnvF"` // 1.1
+		S  string  `def:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" fil:"S" env:"EnvS"` // One
 	}
 	var stGood testGoodStruct
 
@@ -421,10 +535,10 @@ func TestParseFiles(t *testing.T) {
 	f3.Sync()
 
 	type testGoodStruct struct {
-		I  int64   `default:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" env:"EnvI"`     // 1
-		i2 int64   `other:"Foobar"`                                                    //
-		F  float64 `default:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" env:"EnvF"` // 1.1
-		S  string  `default:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" env:"EnvS"` // One
+		I  int64   `def:"VsA2dNX5VkXVwqC-JMHQWCtUWNZ78OPz61OKbB4=" fil:"I" env:"EnvI"`     // 1
+		i2 int64   `other:"Foobar"`                                                        //
+		F  float64 `def:"ZWuWGl8sOQ_gMFsz_l0IllFBmYemsNAennDesZ81ew==" fil:"F" env:"EnvF"` // 1.1
+		S  string  `def:"ZfgUJkrHKNc3_1kOGq0441Guz7GIOs9FzxuQOHfaTg==" fil:"S" env:"EnvS"` // One
 	}
 	var stGood testGoodStruct
 
@@ -484,3 +598,58 @@ func TestParseFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestParseReadersSections(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	bound, _ := kr.EncryptWithOptions("secret", Options{Name: "db.password"})
+	type db struct {
+		Host     string `fil:"host"`
+		Password string `fil:"password"`
+		Port     int64  `fil:"port"`
+	}
+	type testStruct struct {
+		Name      string `fil:"name"`
+		Port      int64  `fil:"port"`
+		DB        db     `fil:"db"`
+		CacheHost string `fil:"cache.host"`
+	}
+	tests := []struct {
+		name        string
+		config      string
+		want        testStruct
+		wantErr     bool
+		wantErrType error
+	}{
+		{"no sections", "name = (app)\n", testStruct{Name: "app"}, false, nil},
+		{"sections", "name = (app)\n\n[db]\nhost = (db)\npassword = " + bound + "\n[ cache ]\nhost = (cache)\n",
+			testStruct{Name: "app", DB: db{Host: "db", Password: "secret"}, CacheHost: "cache"}, false, nil},
+		{"dotted keys", "db.host = (db)\ncache.host = (cache)\n", testStruct{DB: db{Host: "db"}, CacheHost: "cache"}, false, nil},
+		{"end section", "[db]\nhost = (db)\n[]\nname = (app)\n", testStruct{Name: "app", DB: db{Host: "db"}}, false, nil},
+		{"key outside section", "[cache]\nname = (app)\n", testStruct{}, false, nil},
+		{"bound to key", "[db]\npassword = " + bound + "\n", testStruct{DB: db{Password: "secret"}}, false, nil},
+		{"bound to other section", "[cache]\npassword = " + bound + "\n", testStruct{}, true, ErrInvalidKey},
+		{"bad value", "[db]\nport = (x)\n", testStruct{}, true, ErrParse},
+		{"bad value outside section", "port = (x)\n", testStruct{}, true, ErrParse},
+		{"bad dotted value", "db.port = (x)\n", testStruct{}, true, ErrParse},
+		{"bad header", "[db\nhost = (db)\n", testStruct{}, true, ErrBadFileFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			err := kr.ParseReaders(&got, []io.Reader{strings.NewReader(tt.config)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReaders() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("ParseReaders() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseReaders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package cryco
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A config file may carry its own random data key in a header line
+//
+//	#cryco-datakey: <data key encrypted by the master key>
+//
+// The values following the header are encrypted with the data key instead of
+// the master key, so rotating the master key only requires wrapping the data
+// key again instead of re-encrypting every value. Since the header starts with
+// # older versions of this package see it as a comment.
+
+const (
+	dataKeyHeader = "#cryco-datakey:"
+
+	// DataKeyID is the key ID recorded in the envelopes of values encrypted with a data key
+	DataKeyID = "datakey"
+)
+
+// IsDataKeyHeader returns true if the line is a data key header line
+func IsDataKeyHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), dataKeyHeader)
+}
+
+// NewDataKey generates a random AES-256 data key and returns it together with the header
+// line holding it encrypted by the primary key of master
+func NewDataKey(master *Keyring) ([]byte, string, error) {
+	dek, err := GenerateKeySize(KeySize256)
+	if err != nil {
+		return nil, "", err
+	}
+	header, err := wrapDataKey(master, dek)
+	if err != nil {
+		return nil, "", err
+	}
+	return dek, header, nil
+}
+
+// Returns the header line holding the data key encrypted by the primary key of master.
+// The wrapped key is bound to the name datakey so it can't be used as a value.
+func wrapDataKey(master *Keyring, dek []byte) (string, error) {
+	wrapped, err := master.EncryptWithOptions(base64.StdEncoding.EncodeToString(dek), Options{Name: DataKeyID})
+	if err != nil {
+		return "", err
+	}
+	return dataKeyHeader + " " + wrapped, nil
+}
+
+// UnwrapDataKey returns the data key from a header line, decrypting it using master
+func UnwrapDataKey(master *Keyring, header string) ([]byte, error) {
+	s := strings.TrimSpace(header)
+	if !strings.HasPrefix(s, dataKeyHeader) {
+		return nil, fmt.Errorf("%w, not a data key header '%s'", ErrBadFileFormat, s)
+	}
+	plaintext, err := master.DecryptWithName(strings.TrimSpace(s[len(dataKeyHeader):]), DataKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w in data key header", err)
+	}
+	dek, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil || len(dek) != KeySize256 {
+		Wipe(dek)
+		return nil, fmt.Errorf("%w in data key header", ErrBase64)
+	}
+	return dek, nil
+}
+
+// DataKeyring returns a keyring with the data key as its primary key followed by the
+// keys of master, so values in the file encrypted directly by a master key still decrypts.
+// The keyring holds its own copies of the keys, so wipe it when done without affecting master.
+func DataKeyring(master *Keyring, dek []byte) (*Keyring, error) {
+	kr := &Keyring{requireBound: master.requireBound}
+	keys := append([]Key{{ID: DataKeyID, Bytes: dek}}, master.keys...)
+	passphrases := append([]*passphraseKey{nil}, master.passphrases...)
+	for i, k := range keys {
+		b, err := keyCopy(k.Bytes)
+		if err != nil {
+			kr.Wipe()
+			return nil, err
+		}
+		kr.keys = append(kr.keys, Key{ID: k.ID, Bytes: b})
+		kr.passphrases = append(kr.passphrases, passphrases[i])
+	}
+	return kr, nil
+}
+
+// Returns the keyring for the values following the data key header line, the data key
+// followed by the keys of master. The keyring of an earlier header in the file, cur, is
+// wiped unless it is master.
+func headerKeyring(master *Keyring, cur *Keyring, header string) (*Keyring, error) {
+	dek, err := UnwrapDataKey(master, header)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(dek)
+	kr, err := DataKeyring(master, dek)
+	if err != nil {
+		return nil, err
+	}
+	if cur != master {
+		cur.Wipe()
+	}
+	return kr, nil
+}
+
+// AddDataKey reads a file in the key = value format from r and writes it to w with a new
+// data key header line first and every encrypted value decrypted using master and encrypted
+// again using the data key. Returns the number of values that were re-encrypted.
+func AddDataKey(w io.Writer, r io.Reader, master *Keyring) (int, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if IsDataKeyHeader(line) {
+			return 0, fmt.Errorf("%w, already has a data key", ErrBadFileFormat)
+		}
+	}
+	dek, header, err := NewDataKey(master)
+	if err != nil {
+		return 0, err
+	}
+	defer Wipe(dek)
+	if _, err := io.WriteString(w, header+"\n"); err != nil {
+		return 0, err
+	}
+	kr, err := DataKeyring(master, dek)
+	if err != nil {
+		return 0, err
+	}
+	defer kr.Wipe()
+	return Rotate(w, &buf, master, kr)
+}
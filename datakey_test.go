@@ -0,0 +1,119 @@
+package cryco
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapDataKey(t *testing.T) {
+	master, _ := NewKeyring(Key{ID: "master", Bytes: bKeyGood})
+	wrong, _ := NewKeyring(Key{ID: "master", Bytes: bKeyWrong})
+	dek, header, err := NewDataKey(master)
+	if err != nil || len(dek) != KeySize256 || !IsDataKeyHeader(header) {
+		t.Fatalf("NewDataKey() = %v %v %v", dek, header, err)
+	}
+	value, _ := master.EncryptWithOptions("value", Options{Name: "I"})
+
+	tests := []struct {
+		name        string
+		header      string
+		master      *Keyring
+		wantErr     bool
+		wantErrType error
+	}{
+		{"good", header, master, false, nil},
+		{"spaces", "  " + header + " \r\n", master, false, nil},
+		{"wrong key", header, wrong, true, ErrInvalidKey},
+		{"not header", "# " + header, master, true, ErrBadFileFormat},
+		{"value as header", dataKeyHeader + " " + value, master, true, ErrInvalidKey},
+		{"bad base64", dataKeyHeader + " " + badBase64, master, true, ErrBase64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnwrapDataKey(tt.master, tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UnwrapDataKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("UnwrapDataKey() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !bytes.Equal(got, dek) {
+				t.Errorf("UnwrapDataKey() = %v, want %v", got, dek)
+			}
+		})
+	}
+}
+
+func TestParseReadersDataKey(t *testing.T) {
+	master, _ := NewKeyring(Key{ID: "master", Bytes: bKeyGood})
+	dek, header, _ := NewDataKey(master)
+	kr, err := DataKeyring(master, dek)
+	if err != nil {
+		t.Fatalf("DataKeyring() error = %v", err)
+	}
+	sealedI, _ := kr.EncryptWithOptions("5", Options{Name: "I"})
+	sealedS, _ := master.Encrypt("direct")
+	if e, _ := ParseEnvelope(sealedI); e.KeyID != DataKeyID {
+		t.Errorf("DataKeyring() encrypts with key id %v, want %v", e.KeyID, DataKeyID)
+	}
+
+	var s struct {
+		I int64  `fil:"I"`
+		S string `fil:"S"`
+	}
+	cfg := header + "\nI = " + sealedI + "\nS = " + sealedS + "\n"
+	if err := master.ParseReaders(&s, []io.Reader{strings.NewReader(cfg)}); err != nil || s.I != 5 || s.S != "direct" {
+		t.Errorf("ParseReaders() = %+v %v", s, err)
+	}
+	if err := master.ParseReaders(&s, []io.Reader{strings.NewReader("I = " + sealedI + "\n")}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ParseReaders() without header error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestAddDataKey(t *testing.T) {
+	krOld, _ := NewKeyring(Key{ID: "old", Bytes: bKeyGood})
+	krNew, _ := NewKeyring(Key{ID: "new", Bytes: bKey256})
+	sealedI, _ := krOld.EncryptWithOptions("5", Options{Name: "I"})
+	cfg := "# Comment\nI = " + sealedI + "\nF = (3.3)\n"
+
+	var w bytes.Buffer
+	cnt, err := AddDataKey(&w, strings.NewReader(cfg), krOld)
+	if err != nil || cnt != 1 {
+		t.Fatalf("AddDataKey() = %v %v, want 1", cnt, err)
+	}
+	withKey := w.String()
+	lines := strings.Split(withKey, "\n")
+	if len(lines) != 5 || !IsDataKeyHeader(lines[0]) || lines[1] != "# Comment" || lines[3] != "F = (3.3)" {
+		t.Fatalf("AddDataKey() = %q", withKey)
+	}
+	if _, err := AddDataKey(&w, strings.NewReader(withKey), krOld); !errors.Is(err, ErrBadFileFormat) {
+		t.Errorf("AddDataKey() twice error = %v, want %v", err, ErrBadFileFormat)
+	}
+
+	// Rotating the master key only wraps the data key again
+	w.Reset()
+	cnt, err = Rotate(&w, strings.NewReader(withKey), krOld, krNew)
+	if err != nil || cnt != 1 {
+		t.Fatalf("Rotate() = %v %v, want 1", cnt, err)
+	}
+	rotated := strings.Split(w.String(), "\n")
+	if rotated[0] == lines[0] || rotated[2] != lines[2] {
+		t.Errorf("Rotate() = %q, want only the header changed", w.String())
+	}
+	var s struct {
+		I int64 `fil:"I"`
+	}
+	if err := krNew.ParseReaders(&s, []io.Reader{strings.NewReader(w.String())}); err != nil || s.I != 5 {
+		t.Errorf("ParseReaders() = %+v %v", s, err)
+	}
+	if err := krOld.ParseReaders(&s, []io.Reader{strings.NewReader(w.String())}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ParseReaders() with old key error = %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,152 @@
+package cryco
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Parses the dotenv file in the reader, returning true if it had any values. Lines are
+// KEY=value, optionally prefixed by export, with the value unquoted, in single quotes
+// taken literally or in double quotes with \n, \r, \t, \", \\ and \$ escapes. Quoted
+// values may span several lines. A # outside quotes starts a comment if it begins the
+// line or follows whitespace. Values are not expanded. Since the file is shared with
+// other tools only encrypted and (cleartext) values are decrypted, other values are
+// taken as is.
+func parseDotenv(struc interface{}, kr *Keyring, r io.Reader) (bool, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	processed := false
+	// Values are decrypted by the data key once a data key header has been seen
+	fileKr := kr
+	defer func() {
+		if fileKr != kr {
+			fileKr.Wipe()
+		}
+	}()
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		s := strings.TrimSpace(lines[i])
+		if IsDataKeyHeader(s) {
+			dkr, err := headerKeyring(kr, fileKr, s)
+			if err != nil {
+				return false, err
+			}
+			fileKr = dkr
+			continue
+		}
+		// Skip empty lines and comments
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(s, "export ") || strings.HasPrefix(s, "export\t") {
+			s = strings.TrimSpace(s[len("export"):])
+		}
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return false, fmt.Errorf("%w, missing = at line %d", ErrBadFileFormat, lineNo)
+		}
+		name := strings.TrimSpace(s[:eq])
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return false, fmt.Errorf("%w, bad name '%s' at line %d", ErrBadFileFormat, name, lineNo)
+		}
+		value, more, err := dotenvValue(strings.TrimLeft(s[eq+1:], " \t"), lines[i+1:])
+		if err != nil {
+			return false, fmt.Errorf("%w at line %d", err, lineNo)
+		}
+		i += more
+		if IsEnvelope(value) || isCleartext(value) {
+			// Bound values are bound to the name
+			if value, err = fileKr.DecryptWithName(value, name); err != nil {
+				return false, fmt.Errorf("%w at line %d", err, lineNo)
+			}
+		}
+		err = walkPath(reflect.ValueOf(struc).Elem(), name, func(fld reflect.Value) error {
+			return setValue(fld, value)
+		})
+		if err != nil {
+			return false, fmt.Errorf("%w at line %d", err, lineNo)
+		}
+		processed = true
+	}
+	return processed, nil
+}
+
+// Returns the value starting at s, taking lines from next while a quoted value continues,
+// and the number of lines taken
+func dotenvValue(s string, next []string) (string, int, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		// An unquoted value ends at a comment
+		for i := 1; i < len(s); i++ {
+			if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+				s = s[:i]
+				break
+			}
+		}
+		return strings.TrimSpace(s), 0, nil
+	}
+	quote := s[0]
+	s = s[1:]
+	more := 0
+	for {
+		if end := dotenvQuoteEnd(s, quote); end >= 0 {
+			rest := strings.TrimSpace(s[end+1:])
+			if rest != "" && rest[0] != '#' {
+				return "", 0, fmt.Errorf("%w, text after the closing quote", ErrBadFileFormat)
+			}
+			if quote == '\'' {
+				return s[:end], more, nil
+			}
+			return dotenvUnescape(s[:end]), more, nil
+		}
+		if more == len(next) {
+			return "", 0, fmt.Errorf("%w, missing closing quote", ErrBadFileFormat)
+		}
+		s += "\n" + next[more]
+		more++
+	}
+}
+
+// Returns the index of the closing quote, skipping escaped quotes in double quotes, or -1
+func dotenvQuoteEnd(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replaces the escapes in a double quoted value, unknown escapes are kept as is
+func dotenvUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
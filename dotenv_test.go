@@ -0,0 +1,98 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseDotenv(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.EncryptWithOptions("secret", Options{Name: "DB_PASSWORD"})
+
+	type testStruct struct {
+		Host     string `fil:"DB_HOST"`
+		Password string `fil:"DB_PASSWORD"`
+		Port     int64  `fil:"DB_PORT"`
+		Motd     string `fil:"MOTD"`
+	}
+	tests := []struct {
+		name          string
+		env           string
+		want          testStruct
+		wantProcessed bool
+		wantErr       bool
+		wantErrType   error
+	}{
+		{"empty", "", testStruct{}, false, false, nil},
+		{"comments", "# comment\n\n  # indented\n", testStruct{}, false, false, nil},
+		{"plain", "DB_HOST=db\nDB_PORT=5432\n", testStruct{Host: "db", Port: 5432}, true, false, nil},
+		{"export", "export DB_HOST=db\nexport\tDB_PORT = 5432\n", testStruct{Host: "db", Port: 5432}, true, false, nil},
+		{"encrypted", "DB_PASSWORD=" + sealed + "\nDB_HOST=(db)\n", testStruct{Host: "db", Password: "secret"}, true, false, nil},
+		{"quoted encrypted", "DB_PASSWORD=\"" + sealed + "\" # sealed\n", testStruct{Password: "secret"}, true, false, nil},
+		{"inline comment", "DB_HOST=db # the host\nMOTD=a#b\n", testStruct{Host: "db", Motd: "a#b"}, true, false, nil},
+		{"single quotes", "MOTD='a \\n $b # c'\n", testStruct{Motd: "a \\n $b # c"}, true, false, nil},
+		{"double quotes", "MOTD=\"a\\tb\\n\\\"c\\\" \\$d \\\\ \\x\"\n", testStruct{Motd: "a\tb\n\"c\" $d \\ \\x"}, true, false, nil},
+		{"multi-line", "MOTD=\"line 1\nline 2\"\nDB_HOST=db\n", testStruct{Host: "db", Motd: "line 1\nline 2"}, true, false, nil},
+		{"crlf", "DB_HOST=db\r\nDB_PORT=1\r\n", testStruct{Host: "db", Port: 1}, true, false, nil},
+		{"empty value", "DB_HOST=\nMOTD=''\n", testStruct{}, true, false, nil},
+		{"missing =", "DB_HOST\n", testStruct{}, false, true, ErrBadFileFormat},
+		{"bad name", "DB HOST=db\n", testStruct{}, false, true, ErrBadFileFormat},
+		{"unterminated", "DB_HOST=db\nMOTD=\"open\n", testStruct{}, false, true, ErrBadFileFormat},
+		{"after quote", "MOTD='a' b\n", testStruct{}, false, true, ErrBadFileFormat},
+		{"bound to other name", "DB_HOST=" + sealed + "\n", testStruct{}, false, true, ErrInvalidKey},
+		{"bad number", "DB_HOST=db\nDB_PORT=five\n", testStruct{}, false, true, ErrParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			processed, err := parseDotenv(&got, kr, strings.NewReader(tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDotenv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("parseDotenv() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want || processed != tt.wantProcessed {
+				t.Errorf("parseDotenv() = %+v %v, want %+v %v", got, processed, tt.want, tt.wantProcessed)
+			}
+		})
+	}
+	t.Run("error line", func(t *testing.T) {
+		var got testStruct
+		if _, err := parseDotenv(&got, kr, strings.NewReader("MOTD=\"a\nb\"\nDB_HOST\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("parseDotenv() error = %v, want line 3", err)
+		}
+		if _, err := parseDotenv(&got, kr, strings.NewReader("DB_HOST=db\n\nDB_PORT=5432.5\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("parseDotenv() error = %v, want line 3", err)
+		}
+	})
+}
+
+func TestParseFilesDotenv(t *testing.T) {
+	var s struct {
+		I int64  `fil:"I"`
+		S string `fil:"S"`
+	}
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.Encrypt("One")
+	r := WithFormat(strings.NewReader("export I=5\nS=\""+sealed+"\"\n"), FormatDotenv)
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s, []io.Reader{r}); err != nil || s.I != 5 || s.S != "One" {
+		t.Errorf("ParseReadersWith() = %+v %v", s, err)
+	}
+
+	// A .env file is read in the native format, so legacy ciphertexts still decrypt
+	dir := t.TempDir()
+	config := filepath.Join(dir, "app.env")
+	os.WriteFile(config, []byte("I = (6)\nS = "+cipherABC123+"\n"), 0600)
+	if err := ParseFilesWith(StaticProvider{{Bytes: bKeyGood}}, &s, config); err != nil || s.I != 6 || s.S != "ABC123" {
+		t.Errorf("ParseFilesWith() = %+v %v", s, err)
+	}
+}
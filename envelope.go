@@ -0,0 +1,249 @@
+package cryco
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Ciphertexts produced by Encrypt carry a self-describing header in front of
+// the Base64 encoded nonce and sealed data:
+//
+//	cryco:v1:<alg>:<keyid>[:<name>=<value>...]:<payload>
+//
+// The whole header, up to and including the last colon, is authenticated as
+// additional data so it can't be altered without Decrypt noticing. A value
+// bound to its tag name has the aad=name extension and the tag name appended
+// to the additional data, so it only decrypts under that same name. Values
+// without the cryco: prefix are legacy ciphertexts that are just the Base64
+// encoded nonce and sealed data, those are still decrypted as before.
+
+const (
+	envelopeMagic = "cryco"
+	envelopeV1    = "v1"
+
+	// AlgAESGCM is AES-GCM using AES-128, AES-192 or AES-256 depending on the key size
+	AlgAESGCM = "aesgcm"
+	// AlgXChaCha20Poly1305 is XChaCha20-Poly1305 with a 24 byte random nonce, requiring a 32 byte key.
+	// It is fast on hardware without AES acceleration.
+	AlgXChaCha20Poly1305 = "xchacha20poly1305"
+)
+
+var (
+	// ErrEnvelope The ciphertext envelope header is malformed
+	ErrEnvelope = errors.New("Bad ciphertext envelope")
+	// ErrUnsupported The envelope uses a version, algorithm or extension not known to this package
+	ErrUnsupported = errors.New("Unsupported envelope")
+	// ErrKeyID The key ID contains characters not allowed in an envelope
+	ErrKeyID = errors.New("Invalid key ID")
+	// ErrNotBound The value isn't bound to a name although binding is required
+	ErrNotBound = errors.New("Value not bound to its name")
+)
+
+// Extension fields understood by this version of the package. Since the header
+// is authenticated an unknown extension may change how the value should be
+// treated, so values using them are rejected rather than silently decrypted.
+var knownExt = map[string]bool{
+	extAAD:       true,
+	extKDF:       true,
+	extFP:        true,
+	extNotBefore: true,
+	extNotAfter:  true,
+}
+
+const (
+	extAAD     = "aad"  // What is added to the additional data
+	extAADName = "name" // The tag name the value is bound to
+)
+
+var keyIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{0,64}$`)
+
+// Envelope holds the information from the header of an enveloped ciphertext
+type Envelope struct {
+	Version string // Envelope format version, currently always "v1"
+	Alg     string // Algorithm used to seal the value, e.g. AlgAESGCM
+	KeyID   string // Optional ID of the key that sealed the value
+	ext     []string
+}
+
+// IsEnvelope returns true if the value starts with an envelope header
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopeMagic+":")
+}
+
+// ParseEnvelope returns the header information of an enveloped ciphertext
+func ParseEnvelope(value string) (Envelope, error) {
+	e, _, err := parseEnvelope(value)
+	return e, err
+}
+
+// Splits an enveloped ciphertext into its header and the decoded payload
+func parseEnvelope(value string) (Envelope, []byte, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) < 5 || fields[0] != envelopeMagic {
+		return Envelope{}, nil, fmt.Errorf("%w (%s)", ErrEnvelope, value)
+	}
+	e := Envelope{Version: fields[1], Alg: fields[2], KeyID: fields[3], ext: fields[4 : len(fields)-1]}
+	if e.Version != envelopeV1 {
+		return Envelope{}, nil, fmt.Errorf("%w version %s", ErrUnsupported, e.Version)
+	}
+	if !keyIDRegexp.MatchString(e.KeyID) {
+		return Envelope{}, nil, fmt.Errorf("%w (%s)", ErrKeyID, e.KeyID)
+	}
+	for _, x := range e.ext {
+		ss := strings.SplitN(x, "=", 2)
+		if len(ss) < 2 || ss[0] == "" {
+			return Envelope{}, nil, fmt.Errorf("%w extension '%s'", ErrEnvelope, x)
+		}
+		if !knownExt[ss[0]] {
+			return Envelope{}, nil, fmt.Errorf("%w extension %s", ErrUnsupported, ss[0])
+		}
+		if ss[0] == extAAD && ss[1] != extAADName {
+			return Envelope{}, nil, fmt.Errorf("%w extension %s", ErrUnsupported, x)
+		}
+		if ss[0] == extNotBefore || ss[0] == extNotAfter {
+			if _, err := strconv.ParseInt(ss[1], 10, 64); err != nil {
+				return Envelope{}, nil, fmt.Errorf("%w time '%s'", ErrEnvelope, x)
+			}
+		}
+		if ss[0] == extFP && !fingerprintRegexp.MatchString(ss[1]) {
+			return Envelope{}, nil, fmt.Errorf("%w fingerprint '%s'", ErrEnvelope, ss[1])
+		}
+		if ss[0] == extKDF {
+			if _, err := parseKDFParams(ss[1]); err != nil {
+				return Envelope{}, nil, err
+			}
+		}
+	}
+	payload, err := base64.URLEncoding.DecodeString(fields[len(fields)-1])
+	if err != nil {
+		return Envelope{}, nil, fmt.Errorf("%w %v", ErrBase64, err)
+	}
+	return e, payload, nil
+}
+
+// Bound returns true if the value is bound to the tag name it was encrypted for
+func (e Envelope) Bound() bool {
+	v, ok := e.extValue(extAAD)
+	return ok && v == extAADName
+}
+
+// KDF returns the parameters used to derive the key from a passphrase, if it was
+func (e Envelope) KDF() (KDFParams, bool) {
+	v, ok := e.extValue(extKDF)
+	if !ok {
+		return KDFParams{}, false
+	}
+	params, err := parseKDFParams(v)
+	return params, err == nil
+}
+
+// Returns the value of an extension field
+func (e Envelope) extValue(name string) (string, bool) {
+	for _, x := range e.ext {
+		if strings.HasPrefix(x, name+"=") {
+			return x[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// Returns the additional data authenticated together with the value
+func (e Envelope) additionalData(name string) []byte {
+	if e.Bound() {
+		return []byte(e.header() + name)
+	}
+	return []byte(e.header())
+}
+
+// Returns the header in its string form, including the trailing colon
+func (e Envelope) header() string {
+	var sb strings.Builder
+	for _, s := range []string{envelopeMagic, e.Version, e.Alg, e.KeyID} {
+		sb.WriteString(s)
+		sb.WriteString(":")
+	}
+	for _, x := range e.ext {
+		sb.WriteString(x)
+		sb.WriteString(":")
+	}
+	return sb.String()
+}
+
+// Returns the AEAD for the algorithm in the envelope
+func (e Envelope) aead(bKey []byte) (cipher.AEAD, error) {
+	switch e.Alg {
+	case AlgAESGCM, AlgX25519:
+		return newAEAD(bKey)
+	case AlgXChaCha20Poly1305:
+		aead, err := chacha20poly1305.NewX(bKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d, %s needs a 32 byte key", ErrKeySize, len(bKey), e.Alg)
+		}
+		return aead, nil
+	}
+	return nil, fmt.Errorf("%w algorithm %s", ErrUnsupported, e.Alg)
+}
+
+// Seals the plaintext and returns it prefixed by the header, name is the tag
+// name that bound values are bound to
+func (e Envelope) seal(bKey []byte, plaintext string, name string) (string, error) {
+	if !keyIDRegexp.MatchString(e.KeyID) {
+		return "", fmt.Errorf("%w (%s)", ErrKeyID, e.KeyID)
+	}
+	if err := checkZeroKey(bKey); err != nil {
+		return "", err
+	}
+	aead, err := e.aead(bKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), e.additionalData(name))
+	if err != nil {
+		return "", err
+	}
+	return e.header() + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// Opens the payload that was sealed under this header, name is the tag name
+// that bound values must be bound to
+func (e Envelope) open(bKey []byte, payload []byte, name string) (string, error) {
+	var err error
+	if err = checkZeroKey(bKey); err != nil {
+		return "", err
+	}
+	fp := fingerprintFor(e.Alg, bKey)
+	if e.Alg == AlgX25519 {
+		if bKey, payload, err = openX25519(bKey, payload); err != nil {
+			return "", err
+		}
+	}
+	aead, err := e.aead(bKey)
+	if errors.Is(err, ErrKeySize) {
+		// A key of the wrong size for the algorithm isn't the key, so keyrings try the next
+		return "", fmt.Errorf("%w, %w", ErrInvalidKey, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	plainText, err := open(aead, payload, e.additionalData(name))
+	if err != nil && e.Bound() {
+		err = fmt.Errorf("%w (or value not bound to '%s')", err, name)
+	}
+	if err != nil && e.KeyID != "" {
+		err = fmt.Errorf("%w (key id %s)", err, e.KeyID)
+	}
+	if err != nil && e.Fingerprint() != "" {
+		return "", fmt.Errorf("%w (key fingerprint %s, value sealed by %s)", err, fp, e.Fingerprint())
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w (key fingerprint %s)", err, fp)
+	}
+	return plainText, nil
+}
@@ -0,0 +1,246 @@
+package cryco
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        Envelope
+		wantErr     bool
+		wantErrType error
+	}{
+		{"legacy", cipherABC123, Envelope{}, true, ErrEnvelope},
+		{"too few fields", "cryco:v1:aesgcm:" + cipherABC123, Envelope{}, true, ErrEnvelope},
+		{"unknown version", "cryco:v9:aesgcm::" + cipherABC123, Envelope{}, true, ErrUnsupported},
+		{"bad key id", "cryco:v1:aesgcm:a b:" + cipherABC123, Envelope{}, true, ErrKeyID},
+		{"bad extension", "cryco:v1:aesgcm::foo:" + cipherABC123, Envelope{}, true, ErrEnvelope},
+		{"unknown extension", "cryco:v1:aesgcm::foo=bar:" + cipherABC123, Envelope{}, true, ErrUnsupported},
+		{"bad base64", "cryco:v1:aesgcm::" + badBase64, Envelope{}, true, ErrBase64},
+		{"no key id", "cryco:v1:aesgcm::" + cipherABC123, Envelope{"v1", AlgAESGCM, "", []string{}}, false, nil},
+		{"key id", "cryco:v1:aesgcm:prod-2021.1:" + cipherABC123, Envelope{"v1", AlgAESGCM, "prod-2021.1", []string{}}, false, nil},
+		{"unknown algorithm", "cryco:v1:rot13::" + cipherABC123, Envelope{"v1", "rot13", "", []string{}}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvelope(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEnvelope() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("ParseEnvelope() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if got.Version != tt.want.Version || got.Alg != tt.want.Alg || got.KeyID != tt.want.KeyID {
+				t.Errorf("ParseEnvelope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptWithKeyID(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyID       string
+		wantPrefix  string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"no key id", "", "cryco:v1:aesgcm::", false, nil},
+		{"key id", "old", "cryco:v1:aesgcm:old:", false, nil},
+		{"colon in key id", "a:b", "", true, ErrKeyID},
+		{"space in key id", "a b", "", true, ErrKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncryptWithKeyID(bKeyGood, tt.keyID, "ABC123")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EncryptWithKeyID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("EncryptWithKeyID() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("EncryptWithKeyID() = %v, want prefix %v", got, tt.wantPrefix)
+			}
+			e, err := ParseEnvelope(got)
+			if err != nil || e.KeyID != tt.keyID || e.Alg != AlgAESGCM {
+				t.Errorf("ParseEnvelope(EncryptWithKeyID()) = %v %v", e, err)
+			}
+			if plain, err := Decrypt(bKeyGood, got); err != nil || plain != "ABC123" {
+				t.Errorf("Decrypt(EncryptWithKeyID()) = %v %v", plain, err)
+			}
+		})
+	}
+}
+
+func TestDecryptEnvelope(t *testing.T) {
+	good, err := EncryptWithKeyID(bKeyGood, "new", "ABC123")
+	if err != nil {
+		t.Fatalf("EncryptWithKeyID() error = %v", err)
+	}
+	payload := good[strings.LastIndex(good, ":")+1:]
+	tests := []struct {
+		name        string
+		bKey        []byte
+		value       string
+		want        string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"good", bKeyGood, good, "ABC123", false, nil},
+		{"legacy", bKeyGood, cipherABC123, "ABC123", false, nil},
+		{"wrong key", bKeyWrong, good, "", true, ErrInvalidKey},
+		{"short key", bKeyShort, good, "", true, ErrInternal},
+		{"altered key id", bKeyGood, "cryco:v1:aesgcm:old:" + payload, "", true, ErrInvalidKey},
+		{"removed header", bKeyGood, payload, "", true, ErrInvalidKey},
+		{"legacy payload in envelope", bKeyGood, "cryco:v1:aesgcm::" + cipherABC123, "", true, ErrInvalidKey},
+		{"unknown algorithm", bKeyGood, "cryco:v1:rot13:new:" + payload, "", true, ErrUnsupported},
+		{"short payload", bKeyGood, "cryco:v1:aesgcm::" + shortCipher, "", true, ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.bKey, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("Decrypt() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptWithOptionsName(t *testing.T) {
+	bound, err := EncryptWithOptions(bKeyGood, "s3cret", Options{KeyID: "k1", Name: "DB_PASSWORD"})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions() error = %v", err)
+	}
+	if !strings.HasPrefix(bound, "cryco:v1:aesgcm:k1:aad=name:") {
+		t.Errorf("EncryptWithOptions() = %v, want aad=name extension", bound)
+	}
+	if e, err := ParseEnvelope(bound); err != nil || !e.Bound() {
+		t.Errorf("ParseEnvelope().Bound() = %v %v, want true", e.Bound(), err)
+	}
+	unbound, _ := EncryptWithOptions(bKeyGood, "s3cret", Options{})
+	if e, err := ParseEnvelope(unbound); err != nil || e.Bound() {
+		t.Errorf("ParseEnvelope().Bound() = %v %v, want false", e.Bound(), err)
+	}
+	payload := bound[strings.LastIndex(bound, ":")+1:]
+
+	tests := []struct {
+		name        string
+		value       string
+		tagName     string
+		want        string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"same name", bound, "DB_PASSWORD", "s3cret", false, nil},
+		{"swapped name", bound, "API_URL", "", true, ErrInvalidKey},
+		{"no name", bound, "", "", true, ErrInvalidKey},
+		{"binding removed", "cryco:v1:aesgcm:k1:" + payload, "DB_PASSWORD", "", true, ErrInvalidKey},
+		{"unknown binding", "cryco:v1:aesgcm:k1:aad=path:" + payload, "DB_PASSWORD", "", true, ErrUnsupported},
+		{"unbound with name", unbound, "API_URL", "s3cret", false, nil},
+		{"unbound without name", unbound, "", "s3cret", false, nil},
+		{"legacy with name", cipherABC123, "API_URL", "ABC123", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptWithName(bKeyGood, tt.value, tt.tagName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecryptWithName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("DecryptWithName() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("DecryptWithName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptXChaCha20Poly1305(t *testing.T) {
+	tests := []struct {
+		name        string
+		bKey        []byte
+		alg         string
+		wantPrefix  string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"default", bKeyGood, "", "cryco:v1:aesgcm::", false, nil},
+		{"aesgcm", bKey256, AlgAESGCM, "cryco:v1:aesgcm::", false, nil},
+		{"xchacha", bKey256, AlgXChaCha20Poly1305, "cryco:v1:xchacha20poly1305::", false, nil},
+		{"xchacha short key", bKeyGood, AlgXChaCha20Poly1305, "", true, ErrKeySize},
+		{"xchacha 192 key", bKey192, AlgXChaCha20Poly1305, "", true, ErrKeySize},
+		{"unknown", bKey256, "rot13", "", true, ErrUnsupported},
+		{"x25519 needs a public key", bKey256, AlgX25519, "", true, ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncryptWithOptions(tt.bKey, "ABC123", Options{Alg: tt.alg})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EncryptWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("EncryptWithOptions() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("EncryptWithOptions() = %v, want prefix %v", got, tt.wantPrefix)
+			}
+			if plain, err := Decrypt(tt.bKey, got); err != nil || plain != "ABC123" {
+				t.Errorf("Decrypt(EncryptWithOptions()) = %v %v", plain, err)
+			}
+		})
+	}
+
+	sealed, _ := EncryptWithOptions(bKey256, "ABC123", Options{Alg: AlgXChaCha20Poly1305})
+	_, payload, _ := parseEnvelope(sealed)
+	if len(payload) != 24+len("ABC123")+16 {
+		t.Errorf("EncryptWithOptions() payload is %d bytes, want 24 byte nonce", len(payload))
+	}
+	b64 := sealed[strings.LastIndex(sealed, ":")+1:]
+	for _, value := range []string{"cryco:v1:aesgcm::" + b64, "cryco:v1:xchacha20poly1305:x:" + b64} {
+		if _, err := Decrypt(bKey256, value); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Decrypt(%v) error = '%v', wantErr '%v'", value, err, ErrInvalidKey)
+		}
+	}
+	if _, err := Decrypt(bKeyGood, sealed); !errors.Is(err, ErrKeySize) || !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Decrypt() with short key error = '%v', wantErr '%v'", err, ErrKeySize)
+	}
+}
+
+func TestKeyringXChaCha20Poly1305Mixed(t *testing.T) {
+	sealed, _ := EncryptWithOptions(bKey256, "fast", Options{Alg: AlgXChaCha20Poly1305})
+	// The AES-128 and AES-192 keys first in the keyring are too short and skipped
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood}, Key{Bytes: bKey192}, Key{Bytes: bKey256})
+	if got, err := kr.Decrypt(sealed); err != nil || got != "fast" {
+		t.Errorf("Keyring.Decrypt() = %v %v", got, err)
+	}
+	kr, _ = NewKeyring(Key{Bytes: bKeyGood}, Key{Bytes: bKey192})
+	if _, err := kr.Decrypt(sealed); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Keyring.Decrypt() error = '%v', wantErr '%v'", err, ErrInvalidKey)
+	}
+}
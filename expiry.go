@@ -0,0 +1,93 @@
+package cryco
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Values can be limited to a period of time by the nbf (not before) and exp
+// (expires) extensions of the envelope, holding Unix times in seconds. Since
+// the header is authenticated they can't be altered, and Decrypt refuses the
+// value outside of the period with ErrNotYetValid or ErrExpired.
+
+const (
+	extNotBefore = "nbf"
+	extNotAfter  = "exp"
+)
+
+var (
+	// ErrExpired The value has expired, its not after time has passed
+	ErrExpired = errors.New("Value expired")
+	// ErrNotYetValid The not before time of the value hasn't been reached yet
+	ErrNotYetValid = errors.New("Value not yet valid")
+)
+
+var clock atomic.Pointer[func() time.Time]
+
+// SetClock replaces the clock the not before and expiry times are checked against,
+// nil restores the system clock. Meant for tests.
+func SetClock(now func() time.Time) {
+	if now == nil {
+		clock.Store(nil)
+		return
+	}
+	clock.Store(&now)
+}
+
+// Returns the current time from the clock
+func now() time.Time {
+	if f := clock.Load(); f != nil {
+		return (*f)()
+	}
+	return time.Now()
+}
+
+// NotBefore returns the time the value becomes valid, if it was recorded
+func (e Envelope) NotBefore() (time.Time, bool) {
+	return e.timeValue(extNotBefore)
+}
+
+// NotAfter returns the time the value expires, if it was recorded
+func (e Envelope) NotAfter() (time.Time, bool) {
+	return e.timeValue(extNotAfter)
+}
+
+// Returns the time in the extension field
+func (e Envelope) timeValue(name string) (time.Time, bool) {
+	v, ok := e.extValue(name)
+	if !ok {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+// Returns an error if the value isn't valid at the current time
+func (e Envelope) checkTime() error {
+	t := now()
+	if nbf, ok := e.NotBefore(); ok && t.Before(nbf) {
+		return fmt.Errorf("%w until %s", ErrNotYetValid, nbf.UTC().Format(time.RFC3339))
+	}
+	if exp, ok := e.NotAfter(); ok && !t.Before(exp) {
+		return fmt.Errorf("%w at %s", ErrExpired, exp.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Returns the extension fields recording the not before and not after times in the options
+func timeExt(opts Options) []string {
+	var ext []string
+	if !opts.NotBefore.IsZero() {
+		ext = append(ext, extNotBefore+"="+strconv.FormatInt(opts.NotBefore.Unix(), 10))
+	}
+	if !opts.NotAfter.IsZero() {
+		ext = append(ext, extNotAfter+"="+strconv.FormatInt(opts.NotAfter.Unix(), 10))
+	}
+	return ext
+}
@@ -0,0 +1,77 @@
+package cryco
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	t0 := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return t0 })
+	defer SetClock(nil)
+
+	sealed := func(nbf, exp time.Time) string {
+		s, err := EncryptWithOptions(bKeyGood, "secret", Options{NotBefore: nbf, NotAfter: exp})
+		if err != nil {
+			t.Fatalf("EncryptWithOptions() error = %v", err)
+		}
+		return s
+	}
+	tests := []struct {
+		name        string
+		value       string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"no times", sealed(time.Time{}, time.Time{}), false, nil},
+		{"within", sealed(t0.Add(-time.Hour), t0.Add(time.Hour)), false, nil},
+		{"at nbf", sealed(t0, time.Time{}), false, nil},
+		{"not yet valid", sealed(t0.Add(time.Second), time.Time{}), true, ErrNotYetValid},
+		{"expired", sealed(time.Time{}, t0.Add(-time.Second)), true, ErrExpired},
+		{"at exp", sealed(time.Time{}, t0), true, ErrExpired},
+		{"tampered", strings.Replace(sealed(time.Time{}, t0), "exp="+"1893499200", "exp=1893499201", 1), true, ErrInvalidKey},
+		{"bad time", strings.Replace(sealed(time.Time{}, t0), "exp="+"1893499200", "exp=soon", 1), true, ErrEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(bKeyGood, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Decrypt() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != "secret" {
+				t.Errorf("Decrypt() = %v, want secret", got)
+			}
+		})
+	}
+
+	// The times survive a key rotation and stop the keyring from trying other keys
+	value := sealed(t0.Add(-time.Hour), t0.Add(time.Hour))
+	e, _ := ParseEnvelope(value)
+	if nbf, ok := e.NotBefore(); !ok || !nbf.Equal(t0.Add(-time.Hour)) {
+		t.Errorf("NotBefore() = %v %v", nbf, ok)
+	}
+	krOld, _ := NewKeyring(Key{ID: "old", Bytes: bKeyGood})
+	krNew, _ := NewKeyring(Key{ID: "new", Bytes: bKey256})
+	rotated, _, err := rotateLine("S = "+value, "", krOld, krNew, false)
+	if err != nil {
+		t.Fatalf("rotateLine() error = %v", err)
+	}
+	e, _ = ParseEnvelope(strings.TrimPrefix(rotated, "S = "))
+	if exp, ok := e.NotAfter(); !ok || !exp.Equal(t0.Add(time.Hour)) {
+		t.Errorf("rotateLine() NotAfter() = %v %v", exp, ok)
+	}
+	SetClock(func() time.Time { return t0.Add(2 * time.Hour) })
+	kr, _ := NewKeyring(Key{Bytes: bKey256}, Key{Bytes: bKeyGood})
+	if _, err := kr.Decrypt(value); !errors.Is(err, ErrExpired) {
+		t.Errorf("Keyring.Decrypt() error = %v, want %v", err, ErrExpired)
+	}
+}
@@ -0,0 +1,48 @@
+package cryco
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// A key fingerprint identifies a key without revealing anything about it. It is
+// the first 8 bytes of HMAC-SHA256 keyed by the key over a fixed string, in hex.
+// Values can record the fingerprint of the key that sealed them in the fp
+// extension of the envelope, and decryption errors show the fingerprint of the
+// key that was used so a mismatch between keys is easy to spot.
+
+const (
+	extFP           = "fp"
+	fingerprintData = "cryco key fingerprint"
+	fingerprintLen  = 8
+)
+
+var fingerprintRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// KeyFingerprint returns the fingerprint of the key, 16 hex digits
+func KeyFingerprint(bKey []byte) string {
+	mac := hmac.New(sha256.New, bKey)
+	mac.Write([]byte(fingerprintData))
+	return hex.EncodeToString(mac.Sum(nil)[:fingerprintLen])
+}
+
+// Returns the fingerprint recorded for values sealed with the algorithm and key. For
+// x25519 that is the fingerprint of the public key, as that is what values are sealed to.
+func fingerprintFor(alg string, bKey []byte) string {
+	if alg == AlgX25519 {
+		pub, err := PublicKey(bKey)
+		if err != nil {
+			return ""
+		}
+		bKey = pub
+	}
+	return KeyFingerprint(bKey)
+}
+
+// Fingerprint returns the fingerprint of the key that sealed the value, if it was recorded
+func (e Envelope) Fingerprint() string {
+	fp, _ := e.extValue(extFP)
+	return fp
+}
@@ -0,0 +1,81 @@
+package cryco
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	fp := KeyFingerprint(bKeyGood)
+	if !fingerprintRegexp.MatchString(fp) {
+		t.Errorf("KeyFingerprint() = %v, want 16 hex digits", fp)
+	}
+	if fp != KeyFingerprint(append([]byte(nil), bKeyGood...)) {
+		t.Errorf("KeyFingerprint() not stable")
+	}
+	if fp == KeyFingerprint(bKeyWrong) || fp == KeyFingerprint(bKey256) {
+		t.Errorf("KeyFingerprint() same for different keys")
+	}
+}
+
+func TestFingerprintEnvelope(t *testing.T) {
+	sealed, err := EncryptWithOptions(bKeyGood, "secret", Options{Fingerprint: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions() error = %v", err)
+	}
+	e, err := ParseEnvelope(sealed)
+	if err != nil || e.Fingerprint() != KeyFingerprint(bKeyGood) {
+		t.Errorf("ParseEnvelope() = %v %v, want fingerprint %v", e.Fingerprint(), err, KeyFingerprint(bKeyGood))
+	}
+	if got, err := Decrypt(bKeyGood, sealed); err != nil || got != "secret" {
+		t.Errorf("Decrypt() = %v %v", got, err)
+	}
+	_, err = Decrypt(bKeyWrong, sealed)
+	if !errors.Is(err, ErrInvalidKey) || !strings.Contains(err.Error(), KeyFingerprint(bKeyWrong)) ||
+		!strings.Contains(err.Error(), KeyFingerprint(bKeyGood)) {
+		t.Errorf("Decrypt() error = %v, want both fingerprints", err)
+	}
+	plain, _ := Encrypt(bKeyGood, "secret")
+	if _, err := Decrypt(bKeyWrong, plain); err == nil || !strings.Contains(err.Error(), KeyFingerprint(bKeyWrong)) {
+		t.Errorf("Decrypt() error = %v, want key fingerprint", err)
+	}
+	legacy := strings.TrimPrefix(plain, "cryco:v1:aesgcm::")
+	if _, err := Decrypt(bKeyWrong, legacy); err == nil || !strings.Contains(err.Error(), KeyFingerprint(bKeyWrong)) {
+		t.Errorf("Decrypt() legacy error = %v, want key fingerprint", err)
+	}
+
+	// The fingerprint is authenticated and must be well formed
+	other := strings.Replace(sealed, KeyFingerprint(bKeyGood), KeyFingerprint(bKeyWrong), 1)
+	if _, err := Decrypt(bKeyGood, other); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Decrypt() of altered fingerprint error = %v, want %v", err, ErrInvalidKey)
+	}
+	bad := strings.Replace(sealed, KeyFingerprint(bKeyGood), "XYZ", 1)
+	if _, err := Decrypt(bKeyGood, bad); !errors.Is(err, ErrEnvelope) {
+		t.Errorf("Decrypt() of bad fingerprint error = %v, want %v", err, ErrEnvelope)
+	}
+}
+
+func TestFingerprintKeyring(t *testing.T) {
+	// Without key IDs the key is picked by its fingerprint
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood}, Key{Bytes: bKey256})
+	krNew, _ := NewKeyring(Key{Bytes: bKey256})
+	sealed, _ := krNew.EncryptWithOptions("secret", Options{Fingerprint: true})
+	if got, err := kr.Decrypt(sealed); err != nil || got != "secret" {
+		t.Errorf("Decrypt() = %v %v", got, err)
+	}
+	if ks := kr.lookupFingerprint(AlgAESGCM, KeyFingerprint(bKey256)); len(ks) != 1 || !bytes.Equal(kr.keys[ks[0]].Bytes, bKey256) {
+		t.Errorf("lookupFingerprint() = %v", ks)
+	}
+
+	priv, pub, _ := GenerateKeyPair()
+	sealed, _ = EncryptTo(pub, "secret", Options{Fingerprint: true})
+	if e, _ := ParseEnvelope(sealed); e.Fingerprint() != KeyFingerprint(pub) {
+		t.Errorf("EncryptTo() fingerprint = %v, want %v", e.Fingerprint(), KeyFingerprint(pub))
+	}
+	kr, _ = NewKeyring(Key{Bytes: bKeyGood}, Key{Bytes: priv})
+	if got, err := kr.Decrypt(sealed); err != nil || got != "secret" {
+		t.Errorf("Decrypt() x25519 = %v %v", got, err)
+	}
+}
@@ -0,0 +1,194 @@
+package cryco
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Config files can be in other formats than the native key = value lines. A
+// structured document, like a JSON object, is applied to the struct using the fil
+// tags as a path: an object maps onto a nested struct field tagged with the key of
+// the object, so {"db": {"host": "x"}} sets the field tagged fil:"host" in the
+// struct field tagged fil:"db". A field tagged with the dotted path, fil:"db.host",
+// is set as well. Arrays map onto slices of scalars or of structs. String values
+// are decrypted as in the native format with bound values bound to the dotted path.
+
+// Format is the syntax of a config file
+type Format int
+
+const (
+	// FormatNative is lines of key = value, the default
+	FormatNative Format = iota
+	// FormatJSON is a JSON object
+	FormatJSON
+	// FormatYAML is a YAML mapping
+	FormatYAML
+	// FormatTOML is a TOML document
+	FormatTOML
+	// FormatDotenv is a .env file as used by docker compose, never chosen by FormatOf
+	FormatDotenv
+)
+
+// A reader marked with the format of its content
+type formatReader struct {
+	io.Reader
+	format Format
+}
+
+// WithFormat marks the reader as holding a config file in the format, so that
+// ParseReaders parses it as such. Unmarked readers are in the native format.
+func WithFormat(r io.Reader, format Format) io.Reader {
+	return formatReader{Reader: r, format: format}
+}
+
+// FormatOf returns the format of the file given by its extension, .json for JSON,
+// .yaml or .yml for YAML, .toml for TOML and the native format for anything else.
+// Files ending in .env stay in the native format, as they have always been read,
+// dotenv is only used for readers marked with WithFormat.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatNative
+}
+
+// Returns the reader and its format as marked by WithFormat
+func formatOf(r io.Reader) (io.Reader, Format) {
+	if fr, ok := r.(formatReader); ok {
+		return fr.Reader, fr.format
+	}
+	return r, FormatNative
+}
+
+// A node of a document together with its line in the file, for the errors
+type lineNode struct {
+	node interface{}
+	line int
+}
+
+// Applies a decoded document, where objects are map[string]interface{}, arrays are
+// []interface{} and scalars are strings or, not decrypted, other values, to the struct.
+// Returns true if the document had any values.
+func setFromTree(struc interface{}, kr *Keyring, doc map[string]interface{}) (bool, error) {
+	leaves := map[string]interface{}{}
+	flatten(leaves, "", doc)
+	paths := make([]string, 0, len(leaves))
+	for path := range leaves {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := setPath(reflect.ValueOf(struc).Elem(), path, leaves[path], kr, path); err != nil {
+			return false, err
+		}
+	}
+	return len(paths) > 0, nil
+}
+
+// Adds the arrays and scalars of the object to leaves keyed by their dotted path
+func flatten(leaves map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		if m, ok := v.(map[string]interface{}); ok {
+			flatten(leaves, prefix+k+".", m)
+			continue
+		}
+		leaves[prefix+k] = v
+	}
+}
+
+// Sets the field at the dotted path of fil tags in the struct to the node, either a field
+// tagged with the whole path or one tagged with a prefix of it in a nested struct. Values
+// without a field are ignored.
+func setPath(v reflect.Value, path string, node interface{}, kr *Keyring, name string) error {
+	return walkPath(v, path, func(fld reflect.Value) error {
+		return setNode(fld, node, kr, name)
+	})
+}
+
+// Calls set with the fields at the dotted path of fil tags in the struct
+func walkPath(v reflect.Value, path string, set func(reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup(tagFileVal)
+		if !ok {
+			continue
+		}
+		fld := v.Field(i)
+		if tag == path {
+			if !fld.CanSet() {
+				return fmt.Errorf("%w - field %s", ErrNotExported, t.Field(i).Name)
+			}
+			return set(fld)
+		}
+		if fld.Kind() == reflect.Struct && strings.HasPrefix(path, tag+".") {
+			if err := walkPath(fld, path[len(tag)+1:], set); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Sets the field to an array or scalar node, decrypting strings bound to the name
+func setNode(fld reflect.Value, node interface{}, kr *Keyring, name string) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case lineNode:
+		if err := setNode(fld, n.node, kr, name); err != nil {
+			return fmt.Errorf("%w (line %d)", err, n.line)
+		}
+		return nil
+	case []interface{}:
+		if fld.Kind() != reflect.Slice {
+			return fmt.Errorf("%w, array not expected at '%s'", ErrBadFileFormat, name)
+		}
+		s := reflect.MakeSlice(fld.Type(), len(n), len(n))
+		for i, elem := range n {
+			if m, ok := elem.(map[string]interface{}); ok && s.Index(i).Kind() == reflect.Struct {
+				leaves := map[string]interface{}{}
+				flatten(leaves, "", m)
+				for path, leaf := range leaves {
+					if err := setPath(s.Index(i), path, leaf, kr, name+"."+path); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := setNode(s.Index(i), elem, kr, name); err != nil {
+				return err
+			}
+		}
+		fld.Set(s)
+		return nil
+	case map[string]interface{}:
+		return fmt.Errorf("%w, object not expected at '%s'", ErrBadFileFormat, name)
+	case string:
+		value, err := kr.DecryptWithName(n, name)
+		if err != nil {
+			return fmt.Errorf("%w at '%s'", err, name)
+		}
+		return setValue(fld, value)
+	default:
+		return setValue(fld, fmt.Sprint(n))
+	}
+}
+
+// Returns a pointer to the i:th field of the struct if it is an exported nested struct,
+// so that its tags can be applied as well, otherwise nil
+func nestedStruct(e reflect.Value, i int) interface{} {
+	fld := e.Field(i)
+	if fld.Kind() != reflect.Struct || !fld.CanSet() {
+		return nil
+	}
+	return fld.Addr().Interface()
+}
@@ -0,0 +1,134 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     Format
+	}{
+		{"config.json", FormatJSON},
+		{"/etc/app/CONFIG.JSON", FormatJSON},
+		{"config.yaml", FormatYAML},
+		{"config.yml", FormatYAML},
+		{"config.toml", FormatTOML},
+		{".env", FormatNative},
+		{"/srv/app/prod.env", FormatNative},
+		{"config.conf", FormatNative},
+		{"config", FormatNative},
+		{"json", FormatNative},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := FormatOf(tt.filename); got != tt.want {
+				t.Errorf("FormatOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type treeDB struct {
+	Host string `fil:"host" def:"(localhost)"`
+	Port int64  `fil:"port" env:"CRYCOTREE_PORT"`
+}
+
+type treeServer struct {
+	Name string `fil:"name"`
+	Up   bool   `fil:"up"`
+}
+
+type treeStruct struct {
+	S       string       `fil:"s"`
+	DB      treeDB       `fil:"db"`
+	User    string       `fil:"db.user"`
+	Tags    []string     `fil:"tags"`
+	Servers []treeServer `fil:"servers"`
+	hidden  string       `fil:"hidden"`
+}
+
+func Test_setFromTree(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.Encrypt("secret")
+	bound, _ := kr.EncryptWithOptions("admin", Options{Name: "db.user"})
+	wrongName, _ := kr.EncryptWithOptions("admin", Options{Name: "user"})
+
+	tests := []struct {
+		name        string
+		doc         map[string]interface{}
+		want        treeStruct
+		wantErr     bool
+		wantErrType error
+	}{
+		{"empty", map[string]interface{}{}, treeStruct{}, false, nil},
+		{"scalar", map[string]interface{}{"s": sealed}, treeStruct{S: "secret"}, false, nil},
+		{"nested", map[string]interface{}{"db": map[string]interface{}{"host": "(db)", "port": 5432, "user": bound}},
+			treeStruct{DB: treeDB{Host: "db", Port: 5432}, User: "admin"}, false, nil},
+		{"dotted key", map[string]interface{}{"db.host": "(db)"}, treeStruct{DB: treeDB{Host: "db"}}, false, nil},
+		{"arrays", map[string]interface{}{
+			"tags":    []interface{}{"(a)", sealed},
+			"servers": []interface{}{map[string]interface{}{"name": "(x)", "up": true}, map[string]interface{}{"name": "(y)"}},
+		}, treeStruct{Tags: []string{"a", "secret"}, Servers: []treeServer{{"x", true}, {"y", false}}}, false, nil},
+		{"unknown", map[string]interface{}{"x": "1", "db": map[string]interface{}{"x": "1"}}, treeStruct{}, false, nil},
+		{"bound to other name", map[string]interface{}{"db": map[string]interface{}{"user": wrongName}}, treeStruct{}, true, ErrInvalidKey},
+		{"bad value", map[string]interface{}{"db": map[string]interface{}{"port": "(x)"}}, treeStruct{}, true, ErrParse},
+		{"array to scalar", map[string]interface{}{"s": []interface{}{"a"}}, treeStruct{}, true, ErrBadFileFormat},
+		{"object in array", map[string]interface{}{"tags": []interface{}{map[string]interface{}{}}}, treeStruct{}, true, ErrBadFileFormat},
+		{"not exported", map[string]interface{}{"hidden": "(x)"}, treeStruct{}, true, ErrNotExported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got treeStruct
+			_, err := setFromTree(&got, kr, tt.doc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("setFromTree() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("setFromTree() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !equalTree(got, tt.want) {
+				t.Errorf("setFromTree() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalTree(a, b treeStruct) bool {
+	if a.S != b.S || a.DB != b.DB || a.User != b.User || len(a.Tags) != len(b.Tags) || len(a.Servers) != len(b.Servers) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	for i := range a.Servers {
+		if a.Servers[i] != b.Servers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseReadersNested(t *testing.T) {
+	os.Setenv("CRYCOTREE_PORT", "(6000)")
+	defer os.Unsetenv("CRYCOTREE_PORT")
+	var s treeStruct
+	r := WithFormat(strings.NewReader(`{"db": {"port": 5432}}`), FormatJSON)
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s, []io.Reader{r}); err != nil {
+		t.Fatalf("ParseReadersWith() error = %v", err)
+	}
+	// Defaults and environment variables apply to the nested struct as well
+	if s.DB.Host != "localhost" || s.DB.Port != 6000 {
+		t.Errorf("ParseReadersWith() = %+v, want host localhost and port 6000", s.DB)
+	}
+}
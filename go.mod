@@ -1,3 +1,11 @@
 module github.com/mengstr/cryco
 
-go 1.16
+go 1.24.0
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	golang.org/x/crypto v0.45.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.38.0 // indirect
@@ -0,0 +1,153 @@
+package cryco
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Keys and decrypted values are ordinary memory that can end up in core dumps
+// or swap. Harden turns on an opt-in hardened mode for the process where core
+// dumps are disabled and the keys held by keyrings are locked into memory. The
+// keyrings created by the package level parse functions are always wiped when
+// parsing is done, other keyrings are wiped by their Wipe or Close methods.
+// Decrypted values are Go strings and can't be wiped, only the keys can.
+//
+// The keys a provider returns are owned by the caller, NewKeyringFrom copies them
+// into the keyring and wipes the originals. Memory is locked by the page and the
+// locks aren't counted, so keys sharing a page with other locked keys would be
+// unlocked along with them. Instead the locked keys on each page are counted and
+// a page is only unlocked when the last of them is wiped.
+
+var hardened atomic.Bool
+
+// The locked keys by their first byte and the number of locked keys on each page
+var locked = struct {
+	sync.Mutex
+	keys  map[*byte]bool
+	pages map[uintptr]int
+}{keys: map[*byte]bool{}, pages: map[uintptr]int{}}
+
+var pageSize = uintptr(os.Getpagesize())
+
+// Harden turns on the hardened mode. On Linux core dumps are disabled and keys added to
+// keyrings afterwards are locked into memory so they are never swapped out. On other
+// systems it only marks the mode as on.
+func Harden() error {
+	if err := disableCoreDumps(); err != nil {
+		return err
+	}
+	hardened.Store(true)
+	return nil
+}
+
+// Hardened returns true if Harden has been called
+func Hardened() bool {
+	return hardened.Load()
+}
+
+// Wipe overwrites the bytes with zeros, for keys like the one returned by GetKey
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Wipes the bytes of the keys
+func wipeKeys(ks []Key) {
+	for _, k := range ks {
+		Wipe(k.Bytes)
+	}
+}
+
+// Returns a copy of the key held by a keyring, locked into memory in hardened mode
+func keyCopy(bKey []byte) ([]byte, error) {
+	b := append([]byte(nil), bKey...)
+	if Hardened() {
+		if err := lockKey(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Calls f with each page the key is on and the part of the key on that page
+func keyPages(b []byte, f func(page uintptr, part []byte)) {
+	start := uintptr(unsafe.Pointer(&b[0]))
+	for off := uintptr(0); off < uintptr(len(b)); {
+		page := (start + off) &^ (pageSize - 1)
+		end := page + pageSize - start
+		if end > uintptr(len(b)) {
+			end = uintptr(len(b))
+		}
+		f(page, b[off:end])
+		off = end
+	}
+}
+
+// Locks the key into memory and counts it on its pages
+func lockKey(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	locked.Lock()
+	defer locked.Unlock()
+	if err := lockMemory(b); err != nil {
+		return err
+	}
+	if !locked.keys[&b[0]] {
+		locked.keys[&b[0]] = true
+		keyPages(b, func(page uintptr, _ []byte) { locked.pages[page]++ })
+	}
+	return nil
+}
+
+// Uncounts a key locked by lockKey and unlocks the pages no other locked key is on
+func unlockKey(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	locked.Lock()
+	defer locked.Unlock()
+	if !locked.keys[&b[0]] {
+		return
+	}
+	delete(locked.keys, &b[0])
+	keyPages(b, func(page uintptr, part []byte) {
+		if locked.pages[page]--; locked.pages[page] <= 0 {
+			delete(locked.pages, page)
+			unlockMemory(part)
+		}
+	})
+}
+
+// Wipe zeroes all keys held by the keyring, unlocks them from memory and empties it.
+// The keyring holds its own copies of the keys so the caller's slices are left alone.
+func (kr *Keyring) Wipe() {
+	for _, k := range kr.keys {
+		wipeKey(k.Bytes)
+	}
+	for _, pk := range kr.passphrases {
+		if pk != nil {
+			pk.mu.Lock()
+			wipeKey(pk.derived)
+			pk.derived = nil
+			pk.mu.Unlock()
+		}
+	}
+	kr.keys = nil
+	kr.passphrases = nil
+}
+
+// Close wipes the keyring, it can't be used after that
+func (kr *Keyring) Close() error {
+	kr.Wipe()
+	return nil
+}
+
+// Zeroes the key and unlocks it from memory if it was locked
+func wipeKey(b []byte) {
+	Wipe(b)
+	unlockKey(b)
+}
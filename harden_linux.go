@@ -0,0 +1,38 @@
+package cryco
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const prSetDumpable = 4 // PR_SET_DUMPABLE from linux/prctl.h
+
+// Disables core dumps, and ptrace attaching by other processes of the same user,
+// by clearing the dumpable flag and setting the core file size limit to zero
+func disableCoreDumps() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetDumpable, 0, 0); errno != 0 {
+		return fmt.Errorf("%w prctl %v", ErrInternal, errno)
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return fmt.Errorf("%w setrlimit %v", ErrInternal, err)
+	}
+	return nil
+}
+
+// Locks the memory holding b so it is never written to swap
+func lockMemory(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if err := syscall.Mlock(b); err != nil {
+		return fmt.Errorf("%w mlock %v", ErrInternal, err)
+	}
+	return nil
+}
+
+// Unlocks memory locked by lockMemory
+func unlockMemory(b []byte) {
+	if len(b) > 0 {
+		syscall.Munlock(b)
+	}
+}
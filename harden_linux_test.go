@@ -0,0 +1,78 @@
+package cryco
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestDisableCoreDumps(t *testing.T) {
+	if err := disableCoreDumps(); err != nil {
+		t.Fatalf("disableCoreDumps() error = %v", err)
+	}
+	const prGetDumpable = 3
+	dumpable, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prGetDumpable, 0, 0)
+	if errno != 0 || dumpable != 0 {
+		t.Errorf("prctl(PR_GET_DUMPABLE) = %v %v, want 0", dumpable, errno)
+	}
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &rlim); err != nil || rlim.Cur != 0 {
+		t.Errorf("RLIMIT_CORE = %v %v, want 0", rlim.Cur, err)
+	}
+	b := make([]byte, KeySize256)
+	if err := lockMemory(b); err != nil {
+		t.Errorf("lockMemory() error = %v", err)
+	}
+	unlockMemory(b)
+}
+
+// Returns the kB of locked memory of the process
+func lockedKB(t *testing.T) int {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`VmLck:\s+(\d+) kB`).FindSubmatch(status)
+	if m == nil {
+		t.Skip("no VmLck in /proc/self/status")
+	}
+	kB, _ := strconv.Atoi(string(m[1]))
+	return kB
+}
+
+func TestLockKeySharedPage(t *testing.T) {
+	// Two keys on the same page, as separately allocated keys often are
+	b := make([]byte, 2*KeySize256)
+	k1, k2 := b[:KeySize256], b[KeySize256:]
+	before := lockedKB(t)
+	if err := lockKey(k1); err != nil {
+		t.Skipf("lockKey() error = %v", err)
+	}
+	if err := lockKey(k2); err != nil {
+		t.Fatalf("lockKey() error = %v", err)
+	}
+	locked := lockedKB(t)
+	if locked <= before {
+		t.Fatalf("VmLck = %d kB after lockKey(), was %d kB", locked, before)
+	}
+	// Wiping one key keeps the page of the other locked
+	wipeKey(k1)
+	if got := lockedKB(t); got != locked {
+		t.Errorf("VmLck = %d kB after wiping one key, want %d kB", got, locked)
+	}
+	wipeKey(k2)
+	if got := lockedKB(t); got != before {
+		t.Errorf("VmLck = %d kB after wiping both keys, want %d kB", got, before)
+	}
+	// Keys that were never locked don't unlock anything
+	if err := lockKey(k2); err != nil {
+		t.Fatalf("lockKey() error = %v", err)
+	}
+	wipeKey(k1)
+	if got := lockedKB(t); got != locked {
+		t.Errorf("VmLck = %d kB after wiping an unlocked key, want %d kB", got, locked)
+	}
+	wipeKey(k2)
+}
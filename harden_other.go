@@ -0,0 +1,16 @@
+//go:build !linux
+
+package cryco
+
+// Core dumps and memory locking are only handled on Linux
+
+func disableCoreDumps() error {
+	return nil
+}
+
+func lockMemory(b []byte) error {
+	return nil
+}
+
+func unlockMemory(b []byte) {
+}
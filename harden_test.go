@@ -0,0 +1,103 @@
+package cryco
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestKeyringWipe(t *testing.T) {
+	bKey := append([]byte(nil), bKey256...)
+	kr, _ := NewKeyring(Key{ID: "a", Bytes: bKey})
+	held := kr.Keys()[0].Bytes
+	sealed, _ := kr.Encrypt("secret")
+
+	if err := kr.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if !bytes.Equal(bKey, bKey256) {
+		t.Errorf("Wipe() changed the callers key")
+	}
+	if !bytes.Equal(held, make([]byte, KeySize256)) {
+		t.Errorf("Wipe() left key %v", held)
+	}
+	if _, err := kr.Decrypt(sealed); err == nil {
+		t.Errorf("Decrypt() works after Wipe()")
+	}
+}
+
+func TestHarden(t *testing.T) {
+	defer hardened.Store(false)
+	if err := Harden(); err != nil {
+		t.Fatalf("Harden() error = %v", err)
+	}
+	if !Hardened() {
+		t.Errorf("Hardened() = false after Harden()")
+	}
+
+	// Keys are locked and wiped in hardened mode, parsing still works
+	kr, err := NewKeyring(Key{ID: "a", Bytes: bKeyGood}, Key{ID: "b", Bytes: bKey256})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	var s struct {
+		I int64 `fil:"I"`
+	}
+	if err := kr.ParseReaders(&s, []io.Reader{strings.NewReader("I = " + cipher5 + "\n")}); err != nil || s.I != 5 {
+		t.Errorf("ParseReaders() = %+v %v", s, err)
+	}
+	kr.Wipe()
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s, []io.Reader{strings.NewReader("I = " + cipher5 + "\n")}); err != nil {
+		t.Errorf("ParseReadersWith() error = %v", err)
+	}
+	if !bytes.Equal(bKeyGood, []byte("AaaaaaaaaaaaaaaA")) {
+		t.Errorf("ParseReadersWith() wiped the provider key")
+	}
+}
+
+// Provider returning the same keys on every call, to see what happens to them
+type heldProvider []Key
+
+func (p heldProvider) Keys() ([]Key, error) {
+	return p, nil
+}
+
+func TestHardenWipe(t *testing.T) {
+	defer hardened.Store(false)
+	hardened.Store(true)
+
+	// The keys returned by the provider are wiped once copied into the keyring
+	held := heldProvider{{ID: "a", Bytes: append([]byte(nil), bKeyGood...)}}
+	kr, err := NewKeyringFrom(held)
+	if err != nil {
+		t.Fatalf("NewKeyringFrom() error = %v", err)
+	}
+	if !bytes.Equal(held[0].Bytes, make([]byte, KeySize128)) {
+		t.Errorf("NewKeyringFrom() left the provider key %v", held[0].Bytes)
+	}
+	if got, err := kr.Decrypt(cipherABC123); err != nil || got != "ABC123" {
+		t.Errorf("Decrypt() = %v %v", got, err)
+	}
+
+	// The data keyring holds copies of the data key and the master keys
+	dek, _, _ := NewDataKey(kr)
+	dkr, err := DataKeyring(kr, dek)
+	if err != nil {
+		t.Fatalf("DataKeyring() error = %v", err)
+	}
+	Wipe(dek)
+	sealed, _ := dkr.Encrypt("data")
+	if got, err := dkr.Decrypt(sealed); err != nil || got != "data" {
+		t.Errorf("DataKeyring().Decrypt() = %v %v", got, err)
+	}
+	dataKey := dkr.keys[0].Bytes
+	dkr.Wipe()
+	if !bytes.Equal(dataKey, make([]byte, KeySize256)) {
+		t.Errorf("Wipe() left the data key %v", dataKey)
+	}
+	if got, err := kr.Decrypt(cipherABC123); err != nil || got != "ABC123" {
+		t.Errorf("Decrypt() after wiping the data keyring = %v %v", got, err)
+	}
+	kr.Wipe()
+}
@@ -0,0 +1,25 @@
+package cryco
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Parses the JSON object in the reader, returning true if it had any values.
+// Numbers and booleans are taken as is while strings may be encrypted.
+func parseJSON(struc interface{}, kr *Keyring, r io.Reader) (bool, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w %v", ErrBadFileFormat, err)
+	}
+	if dec.More() {
+		return false, fmt.Errorf("%w, data after the JSON object", ErrBadFileFormat)
+	}
+	return setFromTree(struc, kr, doc)
+}
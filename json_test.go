@@ -0,0 +1,90 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseJSON(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.EncryptWithOptions("secret", Options{Name: "db.password"})
+
+	type db struct {
+		Host     string `fil:"host"`
+		Password string `fil:"password"`
+	}
+	type testStruct struct {
+		Name  string  `fil:"name"`
+		Port  int64   `fil:"port"`
+		Ratio float64 `fil:"ratio"`
+		Debug bool    `fil:"debug"`
+		DB    db      `fil:"db"`
+	}
+	tests := []struct {
+		name          string
+		json          string
+		want          testStruct
+		wantProcessed bool
+		wantErr       bool
+		wantErrType   error
+	}{
+		{"empty", "", testStruct{}, false, false, nil},
+		{"empty object", "{}", testStruct{}, false, false, nil},
+		{"values", `{"name": "(app)", "port": 8080, "ratio": 0.5, "debug": true, "db": {"host": "(db)", "password": "` + sealed + `"}}`,
+			testStruct{"app", 8080, 0.5, true, db{"db", "secret"}}, true, false, nil},
+		{"null", `{"name": null}`, testStruct{}, true, false, nil},
+		{"not object", `["a"]`, testStruct{}, false, true, ErrBadFileFormat},
+		{"syntax", `{"name": }`, testStruct{}, false, true, ErrBadFileFormat},
+		{"trailing data", `{} {}`, testStruct{}, false, true, ErrBadFileFormat},
+		{"bad ciphertext", `{"name": "` + badBase64 + `"}`, testStruct{}, false, true, ErrBase64},
+		{"bad number", `{"port": 1.5}`, testStruct{}, false, true, ErrParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			processed, err := parseJSON(&got, kr, strings.NewReader(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("parseJSON() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want || processed != tt.wantProcessed {
+				t.Errorf("parseJSON() = %+v %v, want %+v %v", got, processed, tt.want, tt.wantProcessed)
+			}
+		})
+	}
+}
+
+func TestParseFilesJSON(t *testing.T) {
+	var s struct {
+		I int64  `fil:"I" def:"(1)"`
+		S string `fil:"S"`
+	}
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	config := filepath.Join(dir, "config.json")
+	os.WriteFile(empty, []byte("{}"), 0600)
+	os.WriteFile(config, []byte(`{"I": 5, "S": "`+cipherOne+`"}`), 0600)
+	if err := ParseFilesWith(StaticProvider{{Bytes: bKeyGood}}, &s, filepath.Join(dir, "missing.json"), empty, config); err != nil {
+		t.Fatalf("ParseFilesWith() error = %v", err)
+	}
+	if s.I != 5 || s.S != "One" {
+		t.Errorf("ParseFilesWith() = %+v", s)
+	}
+	var s2 struct {
+		S string `fil:"S"`
+	}
+	r := WithFormat(strings.NewReader(`{"S": "(two)"}`), FormatJSON)
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s2, []io.Reader{r}); err != nil || s2.S != "two" {
+		t.Errorf("ParseReadersWith() = %+v %v", s2, err)
+	}
+}
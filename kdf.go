@@ -0,0 +1,167 @@
+package cryco
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keys derived from a passphrase are AES-256 keys created by scrypt. Values
+// encrypted with such a key records the scrypt parameters and the salt in the
+// kdf extension of the envelope as kdf=scrypt.<logN>.<r>.<p>.<salt> so the key
+// can be derived again from the passphrase when decrypting.
+
+const (
+	extKDF    = "kdf"
+	kdfScrypt = "scrypt"
+
+	minSaltLen = 8
+)
+
+var (
+	// ErrKDF The passphrase, salt or key derivation parameters are not usable
+	ErrKDF = errors.New("Invalid key derivation parameters")
+)
+
+// Set by AllowExpensiveKDF
+var expensiveKDF atomic.Bool
+
+// KDFParams are the scrypt parameters used to derive a key from a passphrase
+type KDFParams struct {
+	Salt []byte // At least 8 bytes of salt
+	LogN int    // CPU/memory cost as log2(N), 10..17, or 10..20 if AllowExpensiveKDF
+	R    int    // Block size, 1..8, or 1..32 if AllowExpensiveKDF
+	P    int    // Parallelization, 1, or 1..16 if AllowExpensiveKDF
+}
+
+// AllowExpensiveKDF raises the limits on the scrypt parameters accepted from envelopes and
+// by DeriveKey, from 128 MiB of memory (logN 17, r 8, p 1) to logN 20, r 32 and p 16. Only
+// turn it on if the envelopes come from a trusted source, since a crafted envelope can then
+// make every Decrypt use gigabytes of memory and seconds of CPU before its MAC is checked.
+func AllowExpensiveKDF(allow bool) {
+	expensiveKDF.Store(allow)
+}
+
+// DefaultKDFParams returns the recommended scrypt parameters using the salt
+func DefaultKDFParams(salt []byte) KDFParams {
+	return KDFParams{Salt: salt, LogN: 15, R: 8, P: 1}
+}
+
+// Verifies that the parameters are within sane limits. The upper limits keeps a
+// crafted envelope from making Decrypt use excessive amounts of memory and time.
+func (p KDFParams) check() error {
+	if len(p.Salt) < minSaltLen {
+		return fmt.Errorf("%w, salt shorter than %d bytes", ErrKDF, minSaltLen)
+	}
+	maxLogN, maxR, maxP := 17, 8, 1
+	if expensiveKDF.Load() {
+		maxLogN, maxR, maxP = 20, 32, 16
+	}
+	if p.LogN < 10 || p.LogN > maxLogN || p.R < 1 || p.R > maxR || p.P < 1 || p.P > maxP {
+		return fmt.Errorf("%w (%s)", ErrKDF, p)
+	}
+	return nil
+}
+
+// String returns the parameters in the form recorded in the envelope
+func (p KDFParams) String() string {
+	return strings.Join([]string{kdfScrypt, strconv.Itoa(p.LogN), strconv.Itoa(p.R), strconv.Itoa(p.P),
+		base64.RawURLEncoding.EncodeToString(p.Salt)}, ".")
+}
+
+// Parses the parameters from the form recorded in the envelope
+func parseKDFParams(s string) (KDFParams, error) {
+	ss := strings.Split(s, ".")
+	if len(ss) != 5 {
+		return KDFParams{}, fmt.Errorf("%w kdf '%s'", ErrEnvelope, s)
+	}
+	if ss[0] != kdfScrypt {
+		return KDFParams{}, fmt.Errorf("%w kdf %s", ErrUnsupported, ss[0])
+	}
+	var p KDFParams
+	var err error
+	for i, v := range []*int{&p.LogN, &p.R, &p.P} {
+		if *v, err = strconv.Atoi(ss[i+1]); err != nil {
+			return KDFParams{}, fmt.Errorf("%w kdf '%s'", ErrEnvelope, s)
+		}
+	}
+	if p.Salt, err = base64.RawURLEncoding.DecodeString(ss[4]); err != nil {
+		return KDFParams{}, fmt.Errorf("%w %v", ErrBase64, err)
+	}
+	return p, p.check()
+}
+
+// Returns true if both parameter sets derives the same key from a passphrase
+func (p KDFParams) equal(o KDFParams) bool {
+	return p.String() == o.String()
+}
+
+// DeriveKey derives an AES-256 key from the passphrase using scrypt
+func DeriveKey(passphrase string, params KDFParams) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w, empty passphrase", ErrKDF)
+	}
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	bKey, err := scrypt.Key([]byte(passphrase), params.Salt, 1<<params.LogN, params.R, params.P, KeySize256)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrKDF, err)
+	}
+	return bKey, nil
+}
+
+// EncryptWithPassphrase derives a key from the passphrase and salt using the default
+// parameters and encrypts the plaintext with it, recording the parameters in the envelope
+func EncryptWithPassphrase(passphrase string, salt []byte, plaintext string, opts Options) (string, error) {
+	params := DefaultKDFParams(salt)
+	bKey, err := DeriveKey(passphrase, params)
+	if err != nil {
+		return "", err
+	}
+	opts.KDF = &params
+	return EncryptWithOptions(bKey, plaintext, opts)
+}
+
+// DecryptWithPassphrase decrypts a value encrypted with a key derived from the passphrase,
+// using the parameters recorded in its envelope to derive the key again
+func DecryptWithPassphrase(passphrase string, value string) (string, error) {
+	if isCleartext(value) {
+		return Decrypt(nil, value)
+	}
+	e, err := ParseEnvelope(value)
+	if err != nil {
+		return "", err
+	}
+	params, ok := e.KDF()
+	if !ok {
+		return "", fmt.Errorf("%w, value not encrypted with a passphrase", ErrKDF)
+	}
+	bKey, err := DeriveKey(passphrase, params)
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(bKey, value)
+}
+
+// Returns the key derived from the passphrase and salt in the environment variables
+// KEY<name>_PASSPHRASE and KEY<name>_SALT together with the passphrase, or nil if there
+// is no passphrase
+func passphraseKeyFromEnv(name string) (Key, *passphraseKey, error) {
+	passphrase := os.Getenv("KEY" + name + "_PASSPHRASE")
+	if passphrase == "" {
+		return Key{}, nil, nil
+	}
+	params := DefaultKDFParams([]byte(os.Getenv("KEY" + name + "_SALT")))
+	bKey, err := DeriveKey(passphrase, params)
+	if err != nil {
+		return Key{}, nil, err
+	}
+	return Key{Bytes: bKey}, &passphraseKey{passphrase: passphrase, params: params}, nil
+}
@@ -0,0 +1,231 @@
+package cryco
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+var saltGood = []byte("NaCl4cryco")
+
+func TestDeriveKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		passphrase  string
+		params      KDFParams
+		wantErr     bool
+		wantErrType error
+	}{
+		{"default", "correct horse", DefaultKDFParams(saltGood), false, nil},
+		{"cheap", "correct horse", KDFParams{saltGood, 10, 1, 1}, false, nil},
+		{"empty passphrase", "", DefaultKDFParams(saltGood), true, ErrKDF},
+		{"short salt", "correct horse", DefaultKDFParams([]byte("NaCl")), true, ErrKDF},
+		{"too expensive", "correct horse", KDFParams{saltGood, 30, 8, 1}, true, ErrKDF},
+		{"zero r", "correct horse", KDFParams{saltGood, 15, 0, 1}, true, ErrKDF},
+		{"logN over limit", "correct horse", KDFParams{saltGood, 18, 8, 1}, true, ErrKDF},
+		{"r over limit", "correct horse", KDFParams{saltGood, 10, 9, 1}, true, ErrKDF},
+		{"p over limit", "correct horse", KDFParams{saltGood, 10, 1, 2}, true, ErrKDF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DeriveKey(tt.passphrase, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeriveKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("DeriveKey() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if len(got) != KeySize256 {
+				t.Errorf("DeriveKey() len = %v, want %v", len(got), KeySize256)
+			}
+			again, _ := DeriveKey(tt.passphrase, tt.params)
+			other, _ := DeriveKey(tt.passphrase+"!", tt.params)
+			if string(got) != string(again) || string(got) == string(other) {
+				t.Errorf("DeriveKey() not deterministic or ignores the passphrase")
+			}
+		})
+	}
+}
+
+func TestParseKDFParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		s           string
+		want        KDFParams
+		wantErr     bool
+		wantErrType error
+	}{
+		{"default", DefaultKDFParams(saltGood).String(), DefaultKDFParams(saltGood), false, nil},
+		{"cheap", "scrypt.10.1.1.TmFDbDRjcnljbw", KDFParams{saltGood, 10, 1, 1}, false, nil},
+		{"unknown kdf", "argon2.10.1.1.TmFDbDRjcnljbw", KDFParams{}, true, ErrUnsupported},
+		{"missing field", "scrypt.10.1.TmFDbDRjcnljbw", KDFParams{}, true, ErrEnvelope},
+		{"not a number", "scrypt.x.1.1.TmFDbDRjcnljbw", KDFParams{}, true, ErrEnvelope},
+		{"bad salt", "scrypt.10.1.1.T!", KDFParams{}, true, ErrBase64},
+		{"too expensive", "scrypt.40.1.1.TmFDbDRjcnljbw", KDFParams{}, true, ErrKDF},
+		{"over limits", "scrypt.20.32.16.TmFDbDRjcnljbw", KDFParams{}, true, ErrKDF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKDFParams(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseKDFParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("parseKDFParams() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !got.equal(tt.want) {
+				t.Errorf("parseKDFParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowExpensiveKDF(t *testing.T) {
+	params := KDFParams{saltGood, 10, 16, 2}
+	if err := params.check(); !errors.Is(err, ErrKDF) {
+		t.Errorf("check() error = %v, want %v", err, ErrKDF)
+	}
+	AllowExpensiveKDF(true)
+	defer AllowExpensiveKDF(false)
+	if err := params.check(); err != nil {
+		t.Errorf("check() with AllowExpensiveKDF error = %v", err)
+	}
+	if err := (KDFParams{saltGood, 21, 8, 1}).check(); !errors.Is(err, ErrKDF) {
+		t.Errorf("check() with AllowExpensiveKDF error = %v, want %v", err, ErrKDF)
+	}
+}
+
+func TestEncryptWithPassphrase(t *testing.T) {
+	sealed, err := EncryptWithPassphrase("correct horse", saltGood, "s3cret", Options{KeyID: "ops"})
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error = %v", err)
+	}
+	if !strings.HasPrefix(sealed, "cryco:v1:aesgcm:ops:kdf=scrypt.15.8.1.TmFDbDRjcnljbw:") {
+		t.Errorf("EncryptWithPassphrase() = %v, want kdf extension", sealed)
+	}
+	if got, err := DecryptWithPassphrase("correct horse", sealed); err != nil || got != "s3cret" {
+		t.Errorf("DecryptWithPassphrase() = %v %v", got, err)
+	}
+	if _, err := DecryptWithPassphrase("wrong horse", sealed); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("DecryptWithPassphrase() error = '%v', wantErr '%v'", err, ErrInvalidKey)
+	}
+	if _, err := DecryptWithPassphrase("correct horse", cipherABC123); !errors.Is(err, ErrEnvelope) {
+		t.Errorf("DecryptWithPassphrase() error = '%v', wantErr '%v'", err, ErrEnvelope)
+	}
+	unsalted, _ := Encrypt(bKeyGood, "s3cret")
+	if _, err := DecryptWithPassphrase("correct horse", unsalted); !errors.Is(err, ErrKDF) {
+		t.Errorf("DecryptWithPassphrase() error = '%v', wantErr '%v'", err, ErrKDF)
+	}
+	bKey, _ := DeriveKey("correct horse", DefaultKDFParams(saltGood))
+	if got, err := Decrypt(bKey, sealed); err != nil || got != "s3cret" {
+		t.Errorf("Decrypt() with derived key = %v %v", got, err)
+	}
+}
+
+func TestKeyringPassphrase(t *testing.T) {
+	otherSalt := []byte("OtherSalt")
+	sealedSame, _ := EncryptWithPassphrase("correct horse", saltGood, "same", Options{})
+	sealedOther, _ := EncryptWithPassphrase("correct horse", otherSalt, "other", Options{})
+
+	kr, _ := NewKeyring(Key{ID: "raw", Bytes: bKeyGood})
+	if err := kr.AddPassphrase("ops", "correct horse", saltGood); err != nil {
+		t.Fatalf("Keyring.AddPassphrase() error = %v", err)
+	}
+	if err := kr.AddPassphrase("bad", "correct horse", []byte("x")); !errors.Is(err, ErrKDF) {
+		t.Errorf("Keyring.AddPassphrase() error = '%v', wantErr '%v'", err, ErrKDF)
+	}
+	for value, want := range map[string]string{sealedSame: "same", sealedOther: "other", cipherABC123: "ABC123"} {
+		if got, err := kr.Decrypt(value); err != nil || got != want {
+			t.Errorf("Keyring.Decrypt() = %v %v, want %v", got, err, want)
+		}
+	}
+
+	krPass, _ := NewKeyring()
+	krPass.AddPassphrase("", "correct horse", saltGood)
+	sealed, _ := krPass.Encrypt("again")
+	if e, _ := ParseEnvelope(sealed); !strings.Contains(sealed, ":kdf=") || e.KeyID != "" {
+		t.Errorf("Keyring.Encrypt() = %v, want kdf extension", sealed)
+	}
+	if got, err := DecryptWithPassphrase("correct horse", sealed); err != nil || got != "again" {
+		t.Errorf("DecryptWithPassphrase(Keyring.Encrypt()) = %v %v", got, err)
+	}
+}
+
+func TestKeyringPassphraseCache(t *testing.T) {
+	os.Setenv("KEYcrycopass_PASSPHRASE", "correct horse")
+	os.Setenv("KEYcrycopass_SALT", string(saltGood))
+	defer os.Unsetenv("KEYcrycopass_PASSPHRASE")
+	defer os.Unsetenv("KEYcrycopass_SALT")
+	kr, err := NewKeyringFrom(Chain(StaticProvider{{ID: "raw", Bytes: bKeyGood}}, EnvProvider{Name: "crycopass"}))
+	if err != nil {
+		t.Fatalf("NewKeyringFrom() error = %v", err)
+	}
+	var sealed []string
+	for _, salt := range []string{"SaltOne1", "SaltTwo2", "SaltThree"} {
+		s, _ := EncryptWithPassphrase("correct horse", []byte(salt), salt, Options{})
+		sealed = append(sealed, s)
+	}
+	// Values using other salts are decrypted by deriving the key again, keeping one key
+	for _, i := range []int{0, 1, 2, 0} {
+		want := []string{"SaltOne1", "SaltTwo2", "SaltThree"}[i]
+		if got, err := kr.Decrypt(sealed[i]); err != nil || got != want {
+			t.Errorf("Keyring.Decrypt() = %v %v, want %v", got, err, want)
+		}
+		if pk := kr.passphrases[1]; pk == nil || !pk.derivedParams.equal(DefaultKDFParams([]byte(want))) {
+			t.Errorf("Keyring derived key cache = %v, want the key for %v", pk, want)
+		}
+	}
+	kr.Wipe()
+	if len(kr.keys) != 0 || len(kr.passphrases) != 0 {
+		t.Errorf("Keyring.Wipe() left keys")
+	}
+}
+
+func TestGetKeyPassphrase(t *testing.T) {
+	want, _ := DeriveKey("correct horse", DefaultKDFParams(saltGood))
+	tests := []struct {
+		name        string
+		envs        map[string]string
+		want        []byte
+		wantErr     bool
+		wantErrType error
+	}{
+		{"passphrase", map[string]string{"_PASSPHRASE": "correct horse", "_SALT": string(saltGood)}, want, false, nil},
+		{"key first", map[string]string{"": keyGoodB64, "_PASSPHRASE": "correct horse", "_SALT": string(saltGood)}, bKeyGood, false, nil},
+		{"missing salt", map[string]string{"_PASSPHRASE": "correct horse"}, nil, true, ErrKDF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for suffix, v := range tt.envs {
+				os.Setenv(envKeyName+suffix, v)
+			}
+			got, err := GetKey()
+			kr, krErr := GetKeyring()
+			for suffix := range tt.envs {
+				os.Unsetenv(envKeyName + suffix)
+			}
+			if (err != nil) != tt.wantErr || (krErr != nil) != tt.wantErr {
+				t.Errorf("GetKey() error = %v, GetKeyring() error = %v, wantErr %v", err, krErr, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) || !errors.Is(krErr, tt.wantErrType) {
+					t.Errorf("GetKey() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if string(got) != string(tt.want) || string(kr.Keys()[0].Bytes) != string(tt.want) {
+				t.Errorf("GetKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
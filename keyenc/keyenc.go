@@ -0,0 +1,58 @@
+// Package keyenc parses and formats the keys used by cryco and its command
+// line tool. Keys are accepted in standard or URL safe Base64, with or without
+// padding, or in hex. They are always formatted in the canonical form, URL
+// safe Base64 with padding, which is also what cryco -gen prints.
+package keyenc
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrEncoding The key isn't in any of the accepted encodings
+	ErrEncoding = errors.New("Bad key encoding")
+)
+
+// Decode returns the key decoded from standard, URL safe or unpadded Base64, or hex.
+// Surrounding whitespace is ignored. A string of 32, 48 or 64 hex digits is taken as
+// hex, the only case where the encodings could be mistaken for each other is a 24 byte
+// key in Base64 consisting of only hex digits, which is too unlikely to matter.
+func Decode(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if isHexKey(s) {
+		return hex.DecodeString(s)
+	}
+	if strings.ContainsAny(s, "-_") && strings.ContainsAny(s, "+/") {
+		return nil, fmt.Errorf("%w, mixed Base64 alphabets", ErrEncoding)
+	}
+	// Map the URL safe alphabet onto the standard one and drop the padding so all
+	// the Base64 variants decode the same way
+	b64 := strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(s, "="))
+	b, err := base64.RawStdEncoding.DecodeString(b64)
+	if err != nil || s == "" {
+		return nil, fmt.Errorf("%w, not Base64 or hex", ErrEncoding)
+	}
+	return b, nil
+}
+
+// Encode returns the key in the canonical form, URL safe Base64 with padding
+func Encode(b []byte) string {
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// Returns true if the string is 32, 48 or 64 hex digits, the sizes of AES keys
+func isHexKey(s string) bool {
+	if len(s) != 32 && len(s) != 48 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package keyenc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	// Chosen to have both + and / in standard Base64
+	key := []byte{0xfb, 0xff, 0xbf, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0xfe}
+	tests := []struct {
+		name    string
+		s       string
+		want    []byte
+		wantErr bool
+	}{
+		{"std", base64.StdEncoding.EncodeToString(key), key, false},
+		{"url", base64.URLEncoding.EncodeToString(key), key, false},
+		{"raw std", base64.RawStdEncoding.EncodeToString(key), key, false},
+		{"raw url", base64.RawURLEncoding.EncodeToString(key), key, false},
+		{"hex", hex.EncodeToString(key), key, false},
+		{"upper hex", "FBFFBF0102030405060708090A0B0CFE", key, false},
+		{"whitespace", " " + Encode(key) + "\n", key, false},
+		{"192 bit", Encode([]byte("AaaaaaaaaaaaaaaaaaaaaaaA")), []byte("AaaaaaaaaaaaaaaaaaaaaaaA"), false},
+		{"mixed alphabets", "+_" + base64.StdEncoding.EncodeToString(key)[2:], nil, true},
+		{"empty", "", nil, true},
+		{"garbage", "not a key!", nil, true},
+		{"truncated", "a", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, ErrEncoding) {
+				t.Errorf("Decode() error = '%v', wantErr '%v'", err, ErrEncoding)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	key := []byte{0xfb, 0xff, 0xbf, 0x01}
+	if got := Encode(key); got != "-_-_AQ==" {
+		t.Errorf("Encode() = %v, want -_-_AQ==", got)
+	}
+}
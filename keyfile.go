@@ -0,0 +1,131 @@
+package cryco
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Keys in environment variables can be read from /proc/<pid>/environ and are
+// inherited by child processes. Instead the keys can be read from a file, named
+// by KEY<executable name>_FILE, or from a file descriptor inherited from the
+// parent process, named by KEY<executable name>_FD. Key files that others than
+// the owner and group have access to are refused.
+
+var (
+	// ErrKeyFilePerm The key file can be accessed by others than its owner and group
+	ErrKeyFilePerm = errors.New("Key file accessible by others")
+)
+
+// Keys already read from inherited file descriptors. A pipe can only be read
+// once so the keys are kept for later calls. In hardened mode the keys aren't
+// kept, the first call takes them and the descriptor is marked as taken.
+var fdKeys = struct {
+	sync.Mutex
+	m     map[uintptr][]Key
+	taken map[uintptr]bool
+}{m: map[uintptr][]Key{}, taken: map[uintptr]bool{}}
+
+// OpenKeyFile opens a file holding keys, refusing it with ErrKeyFilePerm if others
+// than its owner and group can read or write it
+func OpenKeyFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	if err := checkKeyFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Verifies that a regular file isn't accessible by others. Pipes and other special
+// files are accepted. Windows has no such permission bits so nothing is checked there.
+func checkKeyFile(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	if runtime.GOOS == "windows" || !fi.Mode().IsRegular() {
+		return nil
+	}
+	if perm := fi.Mode().Perm(); perm&0007 != 0 {
+		return fmt.Errorf("%w, '%s' has mode %04o", ErrKeyFilePerm, f.Name(), perm)
+	}
+	return nil
+}
+
+// FdProvider reads the keys from a file descriptor inherited from the parent process,
+// like 3 for a shell started with 3<keyfile. The keys are separated by commas or newlines
+// as in FileProvider. The descriptor is read once and then closed. The keys are kept for
+// later calls except in hardened mode, where only the first call gets them and later
+// calls return ErrNoKey, so read them once into a keyring.
+type FdProvider struct {
+	Fd uintptr
+}
+
+// Keys returns the keys read from the file descriptor
+func (p FdProvider) Keys() ([]Key, error) {
+	fdKeys.Lock()
+	defer fdKeys.Unlock()
+	if fdKeys.taken[p.Fd] {
+		return nil, fmt.Errorf("%w, the keys of fd %d are already taken", ErrNoKey, p.Fd)
+	}
+	if ks, ok := fdKeys.m[p.Fd]; ok {
+		if Hardened() {
+			// Hand over the keys kept from before Harden was called
+			delete(fdKeys.m, p.Fd)
+			fdKeys.taken[p.Fd] = true
+			return ks, nil
+		}
+		return copyKeys(ks), nil
+	}
+	f := os.NewFile(p.Fd, "fd "+strconv.FormatUint(uint64(p.Fd), 10))
+	if f == nil {
+		return nil, fmt.Errorf("%w, bad file descriptor %d", ErrInternal, p.Fd)
+	}
+	defer f.Close()
+	if err := checkKeyFile(f); err != nil {
+		return nil, err
+	}
+	ks, err := readKeys(f)
+	if err != nil {
+		return nil, err
+	}
+	if Hardened() {
+		fdKeys.taken[p.Fd] = true
+		return ks, nil
+	}
+	fdKeys.m[p.Fd] = ks
+	return copyKeys(ks), nil
+}
+
+// Returns the keys from the file named by the environment variable KEY<name>_FILE
+// and the file descriptor in KEY<name>_FD
+func keyFilesFromEnv(name string) ([]Key, error) {
+	var keys []Key
+	if path := os.Getenv("KEY" + name + "_FILE"); path != "" {
+		ks, err := FileProvider{Path: path}.Keys()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ks...)
+	}
+	if s := os.Getenv("KEY" + name + "_FD"); s != "" {
+		fd, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%w, bad file descriptor '%s'", ErrInternal, s)
+		}
+		ks, err := FdProvider{Fd: uintptr(fd)}.Keys()
+		if err != nil {
+			wipeKeys(keys)
+			return nil, err
+		}
+		keys = append(keys, ks...)
+	}
+	return keys, nil
+}
@@ -0,0 +1,133 @@
+package cryco
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestOpenKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "keys")
+
+	tests := []struct {
+		name        string
+		perm        os.FileMode
+		wantErr     bool
+		wantErrType error
+	}{
+		{"owner", 0600, false, nil},
+		{"group", 0640, false, nil},
+		{"world readable", 0644, true, ErrKeyFilePerm},
+		{"world writable", 0602, true, ErrKeyFilePerm},
+		{"missing", 0, true, ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filename)
+			if tt.perm != 0 {
+				if err := ioutil.WriteFile(filename, []byte(keyGoodB64), tt.perm); err != nil {
+					t.Fatal(err)
+				}
+				os.Chmod(filename, tt.perm)
+			}
+			f, err := OpenKeyFile(filename)
+			if err == nil {
+				f.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OpenKeyFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("OpenKeyFile() error = '%v', wantErr '%v'", err, tt.wantErrType)
+			}
+		})
+	}
+}
+
+func TestFdProvider(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("new:" + key256B64 + "\nold:" + keyGoodB64 + "\n")
+	w.Close()
+	want := []Key{{ID: "new", Bytes: bKey256}, {ID: "old", Bytes: bKeyGood}}
+
+	fd := r.Fd()
+	os.Setenv("KEYcrycofd_FD", strconv.FormatUint(uint64(fd), 10))
+	defer os.Unsetenv("KEYcrycofd_FD")
+	got, err := FdProvider{Fd: fd}.Keys()
+	r.Close() // Already closed by Keys
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v %v, want %v", got, err, want)
+	}
+	// The pipe is drained and closed, the keys are remembered and not wiped along with the
+	// returned keys
+	Wipe(got[0].Bytes)
+	if got, err := (EnvProvider{Name: "crycofd"}).Keys(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvProvider.Keys() = %v %v, want %v", got, err, want)
+	}
+
+	// In hardened mode the remembered keys are handed over to the first keyring only
+	hardened.Store(true)
+	defer func() {
+		hardened.Store(false)
+		fdKeys.Lock()
+		delete(fdKeys.taken, fd)
+		fdKeys.Unlock()
+	}()
+	kr, err := NewKeyringFrom(EnvProvider{Name: "crycofd"})
+	if err != nil || len(kr.keys) != 2 {
+		t.Errorf("NewKeyringFrom() = %v %v", kr, err)
+	}
+	kr.Wipe()
+	if _, ok := fdKeys.m[fd]; ok {
+		t.Errorf("FdProvider.Keys() kept the keys in hardened mode")
+	}
+	if _, err := (EnvProvider{Name: "crycofd"}).Keys(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("EnvProvider.Keys() error = %v, want %v", err, ErrNoKey)
+	}
+
+	os.Setenv("KEYcrycofd_FD", "three")
+	if _, err := (EnvProvider{Name: "crycofd"}).Keys(); !errors.Is(err, ErrInternal) {
+		t.Errorf("EnvProvider.Keys() error = %v, want %v", err, ErrInternal)
+	}
+}
+
+func TestEnvProviderFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(filename, []byte("file:"+key256B64+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KEYcrycofile", "env:"+keyGoodB64)
+	os.Setenv("KEYcrycofile_FILE", filename)
+	os.Setenv("KEYcrycofile_1", "one:"+key192B64)
+	defer os.Unsetenv("KEYcrycofile")
+	defer os.Unsetenv("KEYcrycofile_FILE")
+	defer os.Unsetenv("KEYcrycofile_1")
+
+	want := []Key{{ID: "env", Bytes: bKeyGood}, {ID: "file", Bytes: bKey256}, {ID: "one", Bytes: bKey192}}
+	if got, err := (EnvProvider{Name: "crycofile"}).Keys(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v %v, want %v", got, err, want)
+	}
+
+	os.Chmod(filename, 0604)
+	if _, err := (EnvProvider{Name: "crycofile"}).Keys(); !errors.Is(err, ErrKeyFilePerm) {
+		t.Errorf("Keys() error = %v, want %v", err, ErrKeyFilePerm)
+	}
+}
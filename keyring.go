@@ -0,0 +1,300 @@
+package cryco
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mengstr/cryco/keyenc"
+)
+
+// Key is a key together with its optional ID
+type Key struct {
+	ID    string
+	Bytes []byte
+}
+
+// Keyring holds one or more keys. The first key is the primary key that is
+// used when encrypting, when decrypting all keys are tried in order so values
+// sealed by either an old or a new key can be read during a key rotation.
+type Keyring struct {
+	keys         []Key
+	passphrases  []*passphraseKey // Parallel to keys, set for the keys derived from a passphrase
+	requireBound bool
+}
+
+// The passphrase a key was derived from, kept so that the key can be derived again
+// for values whose envelopes record other parameters. Only the last key derived that
+// way is kept, so crafted envelopes can't make the keyring grow.
+type passphraseKey struct {
+	passphrase string
+	params     KDFParams // The parameters the key in the keyring was derived with
+
+	mu            sync.Mutex
+	derived       []byte    // The key last derived using other parameters
+	derivedParams KDFParams // and those parameters
+}
+
+// NewKeyring returns a keyring holding the keys, the first key becoming the primary key
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	kr := &Keyring{}
+	for _, k := range keys {
+		if err := kr.Add(k.ID, k.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// Returns a keyring holding just the key, used by the functions taking a single key
+func keyringOf(bKey []byte) *Keyring {
+	return &Keyring{keys: []Key{{Bytes: bKey}}, passphrases: []*passphraseKey{nil}}
+}
+
+// Add appends a key with an optional ID to the keyring
+func (kr *Keyring) Add(id string, bKey []byte) error {
+	return kr.add(Key{ID: id, Bytes: bKey}, nil)
+}
+
+// AddPassphrase appends a key derived from the passphrase and salt with the default
+// parameters. Values whose envelopes records other parameters are decrypted by
+// deriving the key again using those.
+func (kr *Keyring) AddPassphrase(id string, passphrase string, salt []byte) error {
+	params := DefaultKDFParams(salt)
+	bKey, err := DeriveKey(passphrase, params)
+	if err != nil {
+		return err
+	}
+	defer Wipe(bKey)
+	return kr.add(Key{ID: id, Bytes: bKey}, &passphraseKey{passphrase: passphrase, params: params})
+}
+
+// Validates and appends a copy of the key, pk is the passphrase it was derived from or nil
+func (kr *Keyring) add(k Key, pk *passphraseKey) error {
+	if !ValidKeySize(len(k.Bytes)) {
+		return fmt.Errorf("%w %d", ErrKeySize, len(k.Bytes))
+	}
+	if !keyIDRegexp.MatchString(k.ID) {
+		return fmt.Errorf("%w (%s)", ErrKeyID, k.ID)
+	}
+	if k.ID != "" && kr.lookup(k.ID) >= 0 {
+		return fmt.Errorf("%w (%s) already in keyring", ErrKeyID, k.ID)
+	}
+	var err error
+	if k.Bytes, err = keyCopy(k.Bytes); err != nil {
+		return err
+	}
+	kr.keys = append(kr.keys, k)
+	kr.passphrases = append(kr.passphrases, pk)
+	return nil
+}
+
+// Calls f with the i:th key, or when derived is set with the key for a value whose envelope
+// records the key derivation parameters, deriving it again from the passphrase when they
+// differ. The derived key is only valid during the call.
+func (kr *Keyring) withKey(i int, params KDFParams, derived bool, f func([]byte) error) error {
+	pk := kr.passphrases[i]
+	if !derived || pk == nil || pk.params.equal(params) {
+		return f(kr.keys[i].Bytes)
+	}
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if pk.derived == nil || !pk.derivedParams.equal(params) {
+		bKey, err := DeriveKey(pk.passphrase, params)
+		if err != nil {
+			return err
+		}
+		derivedKey, err := keyCopy(bKey)
+		Wipe(bKey)
+		if err != nil {
+			return err
+		}
+		wipeKey(pk.derived)
+		pk.derived, pk.derivedParams = derivedKey, params
+	}
+	return f(pk.derived)
+}
+
+// Keys returns the keys in the keyring, the primary key first
+func (kr *Keyring) Keys() []Key {
+	return append([]Key(nil), kr.keys...)
+}
+
+// Returns the index of the key with the ID, or -1 if there isn't one
+func (kr *Keyring) lookup(id string) int {
+	for i := range kr.keys {
+		if kr.keys[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the indexes of the keys with the fingerprint, or none if the fingerprint is empty
+func (kr *Keyring) lookupFingerprint(alg string, fp string) []int {
+	var is []int
+	for i, k := range kr.keys {
+		if fp != "" && fingerprintFor(alg, k.Bytes) == fp {
+			is = append(is, i)
+		}
+	}
+	return is
+}
+
+// RequireBound makes the keyring refuse to decrypt values read for a tag name that
+// aren't bound to their name, see Options. Cleartext values are still accepted.
+func (kr *Keyring) RequireBound(require bool) {
+	kr.requireBound = require
+}
+
+// Encrypt encrypts the plaintext using the primary key, recording its ID in the envelope
+func (kr *Keyring) Encrypt(plaintext string) (string, error) {
+	return kr.EncryptWithOptions(plaintext, Options{})
+}
+
+// EncryptWithOptions works as Encrypt with the envelope controlled by opts, the KeyID
+// in opts is replaced by the ID of the primary key
+func (kr *Keyring) EncryptWithOptions(plaintext string, opts Options) (string, error) {
+	if len(kr.keys) == 0 {
+		return "", fmt.Errorf("%w no keys in keyring", ErrInvalidKey)
+	}
+	opts.KeyID = kr.keys[0].ID
+	opts.KDF = nil
+	if pk := kr.passphrases[0]; pk != nil {
+		opts.KDF = &pk.params
+	}
+	return EncryptWithOptions(kr.keys[0].Bytes, plaintext, opts)
+}
+
+// Decrypt decrypts the value using the keys in the keyring. If the envelope of the
+// value names a key ID that is in the keyring only that key is used, otherwise the keys
+// are tried in order until one of them succeeds.
+func (kr *Keyring) Decrypt(value string) (string, error) {
+	return kr.DecryptWithName(value, "")
+}
+
+// DecryptWithName works as Decrypt but values bound to a tag name only decrypts if
+// name is the name they were bound to
+func (kr *Keyring) DecryptWithName(value string, name string) (string, error) {
+	return kr.decryptWithName(value, name, true)
+}
+
+// Works as DecryptWithName, checking the not before and expiry times only when checkTime
+// is set
+func (kr *Keyring) decryptWithName(value string, name string, checkTime bool) (string, error) {
+	if isCleartext(value) {
+		return Decrypt(nil, value)
+	}
+	candidates := make([]int, len(kr.keys))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	bound := false
+	var params KDFParams
+	derived := false
+	if IsEnvelope(value) {
+		e, err := ParseEnvelope(value)
+		if err != nil {
+			return "", err
+		}
+		bound = e.Bound()
+		params, derived = e.KDF()
+		if i := kr.lookup(e.KeyID); e.KeyID != "" && i >= 0 {
+			candidates = []int{i}
+		} else if is := kr.lookupFingerprint(e.Alg, e.Fingerprint()); len(is) > 0 {
+			candidates = is
+		}
+	}
+	if kr.requireBound && name != "" && !bound {
+		return "", fmt.Errorf("%w '%s'", ErrNotBound, name)
+	}
+	err := fmt.Errorf("%w no keys in keyring", ErrInvalidKey)
+	for _, i := range candidates {
+		var plaintext string
+		err = kr.withKey(i, params, derived, func(bKey []byte) error {
+			var err error
+			plaintext, err = decryptWithName(bKey, value, name, checkTime)
+			return err
+		})
+		if !errors.Is(err, ErrInvalidKey) {
+			return plaintext, err
+		}
+	}
+	return "", err
+}
+
+// SetDefaults sets the fields tagged with def to their default values
+func (kr *Keyring) SetDefaults(struc interface{}) error {
+	if err := CheckParam(struc); err != nil {
+		return err
+	}
+	return setDefaults(struc, kr)
+}
+
+// SetFromEnv sets the fields tagged with env from environment variables
+func (kr *Keyring) SetFromEnv(struc interface{}) error {
+	return setFromEnv(struc, kr)
+}
+
+// ParseReaders works as the package level ParseReaders but decrypts the values
+// using the keys in the keyring
+func (kr *Keyring) ParseReaders(struc interface{}, readers []io.Reader) error {
+	return parseReaders(struc, kr, readers)
+}
+
+// ParseFiles works as the package level ParseFiles but decrypts the values
+// using the keys in the keyring
+func (kr *Keyring) ParseFiles(struc interface{}, filenames ...string) error {
+	if err := CheckParam(struc); err != nil {
+		return err
+	}
+	rdrs, closeAll := openFiles(filenames)
+	defer closeAll()
+	return parseReaders(struc, kr, rdrs)
+}
+
+// ParseKeys parses a comma separated list of keys, each optionally prefixed by its
+// ID and a colon, like "new:QWFh...,old:QmJi...". The keys may be in standard or
+// URL safe Base64, with or without padding, or in hex, see keyenc.Decode.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var k Key
+		if i := strings.Index(entry, ":"); i >= 0 {
+			k.ID, entry = entry[:i], entry[i+1:]
+		}
+		bKey, err := keyenc.Decode(entry)
+		if err != nil || !ValidKeySize(len(bKey)) {
+			Wipe(bKey)
+			wipeKeys(keys)
+			return nil, fmt.Errorf("%w (%s)", ErrBase64, entry)
+		}
+		k.Bytes = bKey
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// GetKeyring returns a keyring with all configured keys, taken in order from the sources
+// listed at DefaultKeyProvider. Use NewKeyringFrom for keys from another KeyProvider.
+// As with GetKey the all-zero key is used if no keys are configured at all, in strict
+// mode ErrNoKey is returned instead.
+func GetKeyring() (*Keyring, error) {
+	kr, err := NewKeyringFrom(DefaultKeyProvider())
+	if err != nil {
+		return nil, err
+	}
+	if len(kr.keys) == 0 && !zeroKeyAllowed() {
+		return nil, fmt.Errorf("%w configured", ErrNoKey)
+	}
+	if len(kr.keys) == 0 {
+		return keyringOf(make([]byte, KeySize128)), nil
+	}
+	return kr, nil
+}
@@ -0,0 +1,287 @@
+package cryco
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys        []Key
+		wantLen     int
+		wantErr     bool
+		wantErrType error
+	}{
+		{"empty", nil, 0, false, nil},
+		{"one", []Key{{"", bKeyGood}}, 1, false, nil},
+		{"two with ids", []Key{{"new", bKey256}, {"old", bKeyGood}}, 2, false, nil},
+		{"two without ids", []Key{{"", bKey256}, {"", bKeyGood}}, 2, false, nil},
+		{"short key", []Key{{"", bKeyShort}}, 0, true, ErrKeySize},
+		{"bad id", []Key{{"a:b", bKeyGood}}, 0, true, ErrKeyID},
+		{"duplicate id", []Key{{"new", bKey256}, {"new", bKeyGood}}, 0, true, ErrKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewKeyring(tt.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("NewKeyring() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if len(got.Keys()) != tt.wantLen {
+				t.Errorf("NewKeyring() len = %v, want %v", len(got.Keys()), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestKeyringDecrypt(t *testing.T) {
+	krOld, _ := NewKeyring(Key{"old", bKeyGood})
+	krNew, _ := NewKeyring(Key{"new", bKey256})
+	krBoth, _ := NewKeyring(Key{"new", bKey256}, Key{"old", bKeyGood})
+	krNoIDs, _ := NewKeyring(Key{"", bKey256}, Key{"", bKeyGood})
+	krEmpty, _ := NewKeyring()
+
+	sealedOld, _ := krOld.Encrypt("Old")
+	sealedNew, _ := krNew.Encrypt("New")
+	sealedOther, _ := EncryptWithKeyID(bKeyWrong, "old", "Other")
+	if !strings.HasPrefix(sealedNew, "cryco:v1:aesgcm:new:") {
+		t.Fatalf("Keyring.Encrypt() = %v, want primary key id", sealedNew)
+	}
+
+	tests := []struct {
+		name        string
+		kr          *Keyring
+		value       string
+		want        string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"old key old value", krOld, sealedOld, "Old", false, nil},
+		{"old key new value", krOld, sealedNew, "", true, ErrInvalidKey},
+		{"both keys old value", krBoth, sealedOld, "Old", false, nil},
+		{"both keys new value", krBoth, sealedNew, "New", false, nil},
+		{"both keys legacy value", krBoth, cipherABC123, "ABC123", false, nil},
+		{"no ids old value", krNoIDs, sealedOld, "Old", false, nil},
+		{"no ids new value", krNoIDs, sealedNew, "New", false, nil},
+		{"key id of other key", krBoth, sealedOther, "", true, ErrInvalidKey},
+		{"cleartext", krEmpty, "(Clear)", "Clear", false, nil},
+		{"empty keyring", krEmpty, sealedOld, "", true, ErrInvalidKey},
+		{"bad envelope", krBoth, "cryco:v9:aesgcm::" + cipherABC123, "", true, ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.kr.Decrypt(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keyring.Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("Keyring.Decrypt() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Keyring.Decrypt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []Key
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"one", keyGoodB64, []Key{{"", bKeyGood}}, false},
+		{"one with id", "a:" + keyGoodB64, []Key{{"a", bKeyGood}}, false},
+		{"two", "new:" + key256B64 + ", old:" + keyGoodB64, []Key{{"new", bKey256}, {"old", bKeyGood}}, false},
+		{"url", "a:" + base64.URLEncoding.EncodeToString(bKey192), []Key{{ID: "a", Bytes: bKey192}}, false},
+		{"raw", base64.RawStdEncoding.EncodeToString(bKey256), []Key{{ID: "", Bytes: bKey256}}, false},
+		{"hex", "h:" + hex.EncodeToString(bKeyGood), []Key{{ID: "h", Bytes: bKeyGood}}, false},
+		{"bad key", keyBadB64, nil, true},
+		{"bad base64", "a:" + badBase64, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeys(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, ErrBase64) {
+				t.Errorf("ParseKeys() error = '%v', wantErr '%v'", err, ErrBase64)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetKeyring(t *testing.T) {
+	tests := []struct {
+		name        string
+		envs        []string
+		want        []Key
+		wantErr     bool
+		wantErrType error
+	}{
+		{"nothing", nil, []Key{{"", bKeyZero}}, false, nil},
+		{"one", []string{keyGoodB64}, []Key{{"", bKeyGood}}, false, nil},
+		{"list", []string{"new:" + key256B64 + ",old:" + keyGoodB64}, []Key{{"new", bKey256}, {"old", bKeyGood}}, false, nil},
+		{"numbered", []string{"new:" + key256B64, "old:" + keyGoodB64, key192B64}, []Key{{"new", bKey256}, {"old", bKeyGood}, {"", bKey192}}, false, nil},
+		{"numbered without first", []string{"", keyGoodB64}, []Key{{"", bKeyGood}}, false, nil},
+		{"bad key", []string{keyGoodB64, keyBadB64}, nil, true, ErrBase64},
+		{"duplicate id", []string{"a:" + keyGoodB64, "a:" + key256B64}, nil, true, ErrKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := []string{envKeyName, envKeyName + "_1", envKeyName + "_2", envKeyName + "_3"}
+			for i, n := range names {
+				os.Unsetenv(n)
+				if i < len(tt.envs) && tt.envs[i] != "" {
+					os.Setenv(n, tt.envs[i])
+				}
+			}
+			got, err := GetKeyring()
+			for _, n := range names {
+				os.Unsetenv(n)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetKeyring() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("GetKeyring() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Keys(), tt.want) {
+				t.Errorf("GetKeyring() = %v, want %v", got.Keys(), tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringParseReaders(t *testing.T) {
+	type testStruct struct {
+		I int64   `def:"(1)" fil:"I" env:"EnvI"`
+		F float64 `def:"(1.1)" fil:"F" env:"EnvF"`
+		S string  `def:"(One)" fil:"S" env:"EnvS"`
+	}
+	krOld, _ := NewKeyring(Key{"old", bKeyGood})
+	krNew, _ := NewKeyring(Key{"new", bKey256})
+	krBoth, _ := NewKeyring(Key{"new", bKey256}, Key{"old", bKeyGood})
+	sealedI, _ := krOld.Encrypt("2")
+	sealedS, _ := krNew.Encrypt("Two")
+	cfg := "I=" + sealedI + "\nF=(2.2)\nS=" + sealedS + "\n"
+	sealedEnv, _ := krOld.Encrypt("Three")
+
+	tests := []struct {
+		name        string
+		kr          *Keyring
+		want        testStruct
+		wantErr     bool
+		wantErrType error
+	}{
+		{"old key", krOld, testStruct{}, true, ErrInvalidKey},
+		{"new key", krNew, testStruct{}, true, ErrInvalidKey},
+		{"both keys", krBoth, testStruct{2, 2.2, "Three"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			setEnvs("")
+			os.Setenv("EnvS", sealedEnv)
+			err := tt.kr.ParseReaders(&got, []io.Reader{strings.NewReader(cfg)})
+			setEnvs("")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keyring.ParseReaders() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Keyring.ParseReaders() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Keyring.ParseReaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringParseReadersBound(t *testing.T) {
+	type testStruct struct {
+		Password string `def:"(none)" fil:"DB_PASSWORD" env:"EnvDBPassword"`
+		URL      string `fil:"API_URL" env:"EnvAPIURL"`
+	}
+	kr, _ := NewKeyring(Key{"", bKeyGood})
+	krRequire, _ := NewKeyring(Key{"", bKeyGood})
+	krRequire.RequireBound(true)
+
+	password, _ := kr.EncryptWithOptions("s3cret", Options{Name: "DB_PASSWORD"})
+	url, _ := kr.EncryptWithOptions("https://example.com", Options{Name: "API_URL"})
+	unboundURL, _ := kr.Encrypt("https://example.com")
+	envPassword, _ := kr.EncryptWithOptions("s3cret", Options{Name: "EnvDBPassword"})
+	defer os.Unsetenv("EnvDBPassword")
+
+	tests := []struct {
+		name        string
+		kr          *Keyring
+		cfg         string
+		env         string
+		want        testStruct
+		wantErr     bool
+		wantErrType error
+	}{
+		{"bound", kr, "DB_PASSWORD=" + password + "\nAPI_URL=" + url, "", testStruct{"s3cret", "https://example.com"}, false, nil},
+		{"swapped", kr, "DB_PASSWORD=" + password + "\nAPI_URL=" + password, "", testStruct{}, true, ErrInvalidKey},
+		{"env bound", kr, "", envPassword, testStruct{"s3cret", ""}, false, nil},
+		{"file value in env", kr, "", password, testStruct{}, true, ErrInvalidKey},
+		{"unbound allowed", kr, "API_URL=" + unboundURL, "", testStruct{"none", "https://example.com"}, false, nil},
+		{"unbound required", krRequire, "API_URL=" + unboundURL, "", testStruct{}, true, ErrNotBound},
+		{"bound required", krRequire, "DB_PASSWORD=" + password + "\nAPI_URL=(http://localhost)", "", testStruct{"s3cret", "http://localhost"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			os.Unsetenv("EnvDBPassword")
+			if tt.env != "" {
+				os.Setenv("EnvDBPassword", tt.env)
+			}
+			err := tt.kr.ParseReaders(&got, []io.Reader{strings.NewReader(tt.cfg)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keyring.ParseReaders() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Keyring.ParseReaders() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Keyring.ParseReaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
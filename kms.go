@@ -0,0 +1,209 @@
+package cryco
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mengstr/cryco/keyenc"
+)
+
+// The master key can be kept in a key service instead of on disk. The
+// application then ships with a wrapped key, a key encrypted by the key service,
+// and asks the service to unwrap it at startup. The protocol is plain JSON over
+// HTTP so that Vault transit like services can be fronted by a small adapter:
+//
+//	POST <url>/v1/wrap    {"plaintext": "<Base64 key>"}  ->  {"ciphertext": "<wrapped key>"}
+//	POST <url>/v1/unwrap  {"ciphertext": "<wrapped key>"} ->  {"plaintext": "<Base64 key>"}
+//
+// The keys are sent in the canonical form from keyenc.Encode, any form accepted
+// by keyenc.Decode is understood. Errors are returned with a non 2xx status and
+// {"error": "<message>"}. If the service uses a token it is sent as
+// "Authorization: Bearer <token>". KMSHandler is a reference implementation of
+// the service, wrapping the keys using a keyring, and is what cryco kms-serve runs.
+
+const (
+	kmsWrapPath   = "/v1/wrap"
+	kmsUnwrapPath = "/v1/unwrap"
+	kmsName       = "kms" // The name wrapped keys are bound to
+	kmsMaxBody    = 64 * 1024
+)
+
+var (
+	// ErrKMS The key service failed or refused to wrap or unwrap the key
+	ErrKMS = errors.New("Key service error")
+)
+
+// Request and response of the wrap and unwrap calls
+type kmsMessage struct {
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// KMSClient calls a key service using the wrap/unwrap protocol
+type KMSClient struct {
+	URL        string       // Base URL of the service, e.g. https://kms.example.com
+	Token      string       // Optional bearer token
+	HTTPClient *http.Client // Client to use, a client with a 10 second timeout if nil
+}
+
+// Wrap asks the key service to encrypt the key, returning the wrapped key
+func (c *KMSClient) Wrap(bKey []byte) (string, error) {
+	resp, err := c.call(kmsWrapPath, kmsMessage{Plaintext: keyenc.Encode(bKey)})
+	if err != nil {
+		return "", err
+	}
+	return resp.Ciphertext, nil
+}
+
+// Unwrap asks the key service to decrypt the wrapped key
+func (c *KMSClient) Unwrap(wrapped string) ([]byte, error) {
+	resp, err := c.call(kmsUnwrapPath, kmsMessage{Ciphertext: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	bKey, err := keyenc.Decode(resp.Plaintext)
+	if err != nil || !ValidKeySize(len(bKey)) {
+		Wipe(bKey)
+		return nil, fmt.Errorf("%w, unwrapped key is not a valid key", ErrKMS)
+	}
+	return bKey, nil
+}
+
+// Posts the request to the path of the service and returns its response
+func (c *KMSClient) call(path string, req kmsMessage) (kmsMessage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return kmsMessage{}, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	hreq, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return kmsMessage{}, fmt.Errorf("%w %v", ErrKMS, err)
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return kmsMessage{}, fmt.Errorf("%w %v", ErrKMS, err)
+	}
+	defer hresp.Body.Close()
+	var resp kmsMessage
+	if err := json.NewDecoder(io.LimitReader(hresp.Body, kmsMaxBody)).Decode(&resp); err != nil {
+		return kmsMessage{}, fmt.Errorf("%w, bad response (%s) %v", ErrKMS, hresp.Status, err)
+	}
+	if hresp.StatusCode/100 != 2 {
+		return kmsMessage{}, fmt.Errorf("%w (%s) %s", ErrKMS, hresp.Status, resp.Error)
+	}
+	return resp, nil
+}
+
+// KMSProvider returns the key unwrapped by the key service, recorded under the ID
+type KMSProvider struct {
+	Client  *KMSClient
+	Wrapped string // The wrapped key
+	ID      string // Optional ID of the key
+}
+
+// Keys returns the unwrapped key
+func (p KMSProvider) Keys() ([]Key, error) {
+	bKey, err := p.Client.Unwrap(p.Wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return []Key{{ID: p.ID, Bytes: bKey}}, nil
+}
+
+// Returns the key unwrapped by the key service at the URL in KEY<name>_KMS_URL, the
+// wrapped key taken from KEY<name>_WRAPPED and the optional token from KEY<name>_KMS_TOKEN
+func kmsKeysFromEnv(name string) ([]Key, error) {
+	url := os.Getenv("KEY" + name + "_KMS_URL")
+	wrapped := os.Getenv("KEY" + name + "_WRAPPED")
+	if url == "" && wrapped == "" {
+		return nil, nil
+	}
+	if url == "" || wrapped == "" {
+		return nil, fmt.Errorf("%w, both KEY%s_KMS_URL and KEY%s_WRAPPED are needed", ErrKMS, name, name)
+	}
+	client := &KMSClient{URL: url, Token: os.Getenv("KEY" + name + "_KMS_TOKEN")}
+	return KMSProvider{Client: client, Wrapped: wrapped}.Keys()
+}
+
+// KMSHandler returns an http.Handler serving the wrap/unwrap protocol, wrapping keys with
+// the primary key of the keyring and unwrapping with any of its keys. Only values wrapped
+// by the handler, bound to the name kms and holding a key, are unwrapped, so other values
+// encrypted with the same keys can't be decrypted through it. Requests must carry the
+// token unless it is empty.
+func KMSHandler(kr *Keyring, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(kmsWrapPath, kmsHandle(token, func(req kmsMessage) (kmsMessage, error) {
+		bKey, err := keyenc.Decode(req.Plaintext)
+		defer Wipe(bKey)
+		if err != nil || !ValidKeySize(len(bKey)) {
+			return kmsMessage{}, fmt.Errorf("%w, plaintext is not a valid key", ErrKeySize)
+		}
+		wrapped, err := kr.EncryptWithOptions(keyenc.Encode(bKey), Options{Name: kmsName})
+		return kmsMessage{Ciphertext: wrapped}, err
+	}))
+	mux.HandleFunc(kmsUnwrapPath, kmsHandle(token, func(req kmsMessage) (kmsMessage, error) {
+		if e, err := ParseEnvelope(req.Ciphertext); err != nil || !e.Bound() {
+			return kmsMessage{}, fmt.Errorf("%w, not a wrapped key", ErrNotBound)
+		}
+		plaintext, err := kr.DecryptWithName(req.Ciphertext, kmsName)
+		if err != nil {
+			return kmsMessage{}, err
+		}
+		bKey, err := keyenc.Decode(plaintext)
+		defer Wipe(bKey)
+		if err != nil || !ValidKeySize(len(bKey)) {
+			return kmsMessage{}, fmt.Errorf("%w, not a wrapped key", ErrKeySize)
+		}
+		return kmsMessage{Plaintext: keyenc.Encode(bKey)}, nil
+	}))
+	return mux
+}
+
+// Returns a handler checking the method and token, decoding the request and encoding
+// the response or error from f
+func kmsHandle(token string, f func(kmsMessage) (kmsMessage, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reply := func(status int, msg kmsMessage) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(msg)
+		}
+		if r.Method != http.MethodPost {
+			reply(http.StatusMethodNotAllowed, kmsMessage{Error: "use POST"})
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if token != "" && subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			reply(http.StatusUnauthorized, kmsMessage{Error: "bad token"})
+			return
+		}
+		var req kmsMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, kmsMaxBody)).Decode(&req); err != nil {
+			reply(http.StatusBadRequest, kmsMessage{Error: "bad request"})
+			return
+		}
+		resp, err := f(req)
+		if err != nil {
+			reply(http.StatusBadRequest, kmsMessage{Error: err.Error()})
+			return
+		}
+		reply(http.StatusOK, resp)
+	}
+}
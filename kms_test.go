@@ -0,0 +1,147 @@
+package cryco
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKMSClient(t *testing.T) {
+	kr, _ := NewKeyring(Key{ID: "kms", Bytes: bKey256})
+	srv := httptest.NewServer(KMSHandler(kr, "t0ken"))
+	defer srv.Close()
+	other := httptest.NewServer(KMSHandler(keyringOf(bKeyWrong), ""))
+	defer other.Close()
+
+	client := &KMSClient{URL: srv.URL + "/", Token: "t0ken"}
+	wrapped, err := client.Wrap(bKeyGood)
+	if err != nil || !IsEnvelope(wrapped) {
+		t.Fatalf("Wrap() = %v %v", wrapped, err)
+	}
+	if _, err := client.Wrap([]byte("short")); !errors.Is(err, ErrKMS) {
+		t.Errorf("Wrap() of bad key error = %v, want %v", err, ErrKMS)
+	}
+	value, _ := kr.EncryptWithOptions(keyGoodB64, Options{Name: "I"})
+	unbound, _ := kr.Encrypt(keyGoodB64)
+	notKey, _ := kr.EncryptWithOptions("s3cret", Options{Name: kmsName})
+
+	tests := []struct {
+		name        string
+		client      *KMSClient
+		wrapped     string
+		want        []byte
+		wantErr     bool
+		wantErrType error
+	}{
+		{"good", client, wrapped, bKeyGood, false, nil},
+		{"no token", &KMSClient{URL: srv.URL}, wrapped, nil, true, ErrKMS},
+		{"wrong token", &KMSClient{URL: srv.URL, Token: "other"}, wrapped, nil, true, ErrKMS},
+		{"wrong server key", &KMSClient{URL: other.URL}, wrapped, nil, true, ErrKMS},
+		{"not wrapped key", client, value, nil, true, ErrKMS},
+		{"not bound", client, unbound, nil, true, ErrKMS},
+		{"bound not a key", client, notKey, nil, true, ErrKMS},
+		{"legacy", client, cipherABC123, nil, true, ErrKMS},
+		{"no server", &KMSClient{URL: "http://127.0.0.1:1"}, wrapped, nil, true, ErrKMS},
+		{"not a service", &KMSClient{URL: srv.URL + "/nothing"}, wrapped, nil, true, ErrKMS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.Unwrap(tt.wrapped)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unwrap() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Unwrap() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Unwrap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKMSHandler(t *testing.T) {
+	kr := keyringOf(bKey256)
+	h := KMSHandler(kr, "")
+	wrapped, _ := kr.EncryptWithOptions(keyGoodB64, Options{Name: kmsName})
+	unbound, _ := kr.Encrypt("s3cret")
+	notKey, _ := kr.EncryptWithOptions("s3cret", Options{Name: kmsName})
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"get", http.MethodGet, kmsUnwrapPath, "", http.StatusMethodNotAllowed},
+		{"bad json", http.MethodPost, kmsUnwrapPath, "{", http.StatusBadRequest},
+		{"too large", http.MethodPost, kmsUnwrapPath, `{"ciphertext":"` + strings.Repeat("a", kmsMaxBody) + `"}`, http.StatusBadRequest},
+		{"unknown path", http.MethodPost, "/v2/unwrap", "{}", http.StatusNotFound},
+		{"wrap", http.MethodPost, kmsWrapPath, `{"plaintext":"` + keyGoodB64 + `"}`, http.StatusOK},
+		{"unwrap", http.MethodPost, kmsUnwrapPath, `{"ciphertext":"` + wrapped + `"}`, http.StatusOK},
+		{"unwrap unbound value", http.MethodPost, kmsUnwrapPath, `{"ciphertext":"` + unbound + `"}`, http.StatusBadRequest},
+		{"unwrap value not a key", http.MethodPost, kmsUnwrapPath, `{"ciphertext":"` + notKey + `"}`, http.StatusBadRequest},
+		{"unwrap legacy", http.MethodPost, kmsUnwrapPath, `{"ciphertext":"` + cipherABC123 + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() = %v, want %v (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "s3cret") {
+				t.Errorf("ServeHTTP() = %s, leaks the plaintext", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestKMSEnvProvider(t *testing.T) {
+	kr, _ := NewKeyring(Key{ID: "kms", Bytes: bKey256})
+	srv := httptest.NewServer(KMSHandler(kr, "t0ken"))
+	defer srv.Close()
+	wrapped, _ := (&KMSClient{URL: srv.URL, Token: "t0ken"}).Wrap(bKeyGood)
+	defer os.Unsetenv("KEYcrycokms_KMS_URL")
+	defer os.Unsetenv("KEYcrycokms_KMS_TOKEN")
+	defer os.Unsetenv("KEYcrycokms_WRAPPED")
+
+	tests := []struct {
+		name        string
+		url         string
+		token       string
+		wrapped     string
+		want        []Key
+		wantErrType error
+	}{
+		{"good", srv.URL, "t0ken", wrapped, []Key{{ID: "", Bytes: bKeyGood}}, nil},
+		{"nothing", "", "", "", nil, nil},
+		{"no wrapped key", srv.URL, "t0ken", "", nil, ErrKMS},
+		{"no url", "", "", wrapped, nil, ErrKMS},
+		{"wrong token", srv.URL, "other", wrapped, nil, ErrKMS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KEYcrycokms_KMS_URL", tt.url)
+			os.Setenv("KEYcrycokms_KMS_TOKEN", tt.token)
+			os.Setenv("KEYcrycokms_WRAPPED", tt.wrapped)
+			got, err := EnvProvider{Name: "crycokms"}.Keys()
+			if !errors.Is(err, tt.wantErrType) {
+				t.Errorf("Keys() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -14,18 +15,28 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	keylen     = 16 // AES128
+	// KeySize128 is the length in bytes of an AES-128 key
+	KeySize128 = 16
+	// KeySize192 is the length in bytes of an AES-192 key
+	KeySize192 = 24
+	// KeySize256 is the length in bytes of an AES-256 key
+	KeySize256 = 32
+
 	tagDefVal  = "def"
 	tagFileVal = "fil"
 	tagEnvVal  = "env"
+	tagCredVal = "cred"
 )
 
 var (
 	// Set by go build -ldflags "-X github.com/mengstr/cryco.key=......."
 	key = ""
+	// Set by go build -ldflags "-X github.com/mengstr/cryco.keys=<id>:.......,<id>:......."
+	keys = ""
 )
 
 var (
@@ -45,6 +56,8 @@ var (
 	ErrInternal = errors.New("Internal/OS error")
 	// ErrInvalidKey ...
 	ErrInvalidKey = errors.New("Invalid key")
+	// ErrKeySize The key is not 16, 24 or 32 bytes long
+	ErrKeySize = errors.New("Invalid key size")
 )
 
 // Returns the sanatized name of the running program
@@ -62,61 +75,214 @@ func exeName() (string, error) {
 	return reg.ReplaceAllString(s, ""), nil
 }
 
+// ValidKeySize returns true if size is a key length in bytes usable by AES-128, AES-192 or AES-256
+func ValidKeySize(size int) bool {
+	return size == KeySize128 || size == KeySize192 || size == KeySize256
+}
+
 // GetKey Returns the active key decoded from its original Base64 encoding
-// The key is retreived from either an environment variable named KEY<executable name>
-// or locally from the executable using a variable that got its value patched into
-// it during build.
+// It is the primary key of DefaultKeyProvider, taken from the first of the sources listed there
+// that has a key.
+// If no key is configured the all-zero key is returned, or ErrNoKey in strict mode.
 func GetKey() ([]byte, error) {
-	name, err := exeName()
+	zeroKey := make([]byte, KeySize128)
+	if !zeroKeyAllowed() {
+		zeroKey = nil
+	}
+	ks, err := DefaultKeyProvider().Keys()
 	if err != nil {
-		return nil, err
+		return zeroKey, err
 	}
-	s := os.Getenv("KEY" + name)
-	if s == "" {
-		s = key
+	if len(ks) == 0 {
+		if zeroKey == nil {
+			return nil, fmt.Errorf("%w configured", ErrNoKey)
+		}
+		return zeroKey, nil
 	}
-	if s == "" {
-		return []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, nil
+	wipeKeys(ks[1:])
+	return ks[0].Bytes, nil
+}
+
+// GenerateKey returns a new random AES-128 key suitable for Encrypt and Decrypt
+func GenerateKey() ([]byte, error) {
+	return GenerateKeySize(KeySize128)
+}
+
+// GenerateKeySize returns a new random key of size bytes, which must be one of
+// KeySize128, KeySize192 or KeySize256
+func GenerateKeySize(size int) ([]byte, error) {
+	if !ValidKeySize(size) {
+		return nil, fmt.Errorf("%w %d", ErrKeySize, size)
 	}
-	bKey, err := base64.StdEncoding.DecodeString(s)
-	if err != nil || len(bKey) != keylen {
-		return []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, fmt.Errorf("%w (%s)", ErrBase64, s)
+	bKey := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, bKey); err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
 	}
 	return bKey, nil
 }
 
-// Decrypt takes a base64 encoded ciphertext string and decrypts it into a cleartext string
-// If value string is bracketed with paranthesis () then it should be treated as cleartext so
-// remove the paranthesises and return as is
-func Decrypt(bKey []byte, cipherB64 string) (string, error) {
-	// Cleartext?
-	if len(cipherB64) > 1 && cipherB64[0:1] == "(" && cipherB64[len(cipherB64)-1:] == ")" {
-		return cipherB64[1 : len(cipherB64)-1], nil
-	}
-	encryptData, err := base64.URLEncoding.DecodeString(cipherB64)
-	if err != nil {
-		return "", fmt.Errorf("%w %v", ErrBase64, err)
-	}
+// Cleartext returns the value bracketed with paranthesis () so that Decrypt
+// will pass it through as is instead of trying to decrypt it
+func Cleartext(value string) string {
+	return "(" + value + ")"
+}
+
+// Returns an AES-GCM AEAD for the key
+func newAEAD(bKey []byte) (cipher.AEAD, error) {
 	cipherBlock, err := aes.NewCipher(bKey)
 	if err != nil {
-		return "", fmt.Errorf("%w (a)", ErrInternal)
+		return nil, fmt.Errorf("%w (a)", ErrInternal)
 	}
 	aead, err := cipher.NewGCM(cipherBlock)
 	if err != nil {
-		return "", fmt.Errorf("%w (b)", ErrInternal)
+		return nil, fmt.Errorf("%w (b)", ErrInternal)
+	}
+	return aead, nil
+}
+
+// Seals the plaintext with a random nonce and returns the nonce followed by the sealed data
+func seal(aead cipher.AEAD, plainText []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
 	}
+	return aead.Seal(nonce, nonce, plainText, additionalData), nil
+}
+
+// Splits the data into nonce and sealed data and opens it
+func open(aead cipher.AEAD, encryptData []byte, additionalData []byte) (string, error) {
 	nonceSize := aead.NonceSize()
 	if len(encryptData) < nonceSize {
 		return "", fmt.Errorf("%w (c)", ErrInternal)
 	}
 	nonce, cipherText := encryptData[:nonceSize], encryptData[nonceSize:]
-	plainData, err := aead.Open(nil, nonce, cipherText, nil)
+	plainData, err := aead.Open(nil, nonce, cipherText, additionalData)
 	if err != nil {
 		return "", fmt.Errorf("%w %v", ErrInvalidKey, err)
 	}
 	return string(plainData), nil
 }
 
+// Options controls how EncryptWithOptions seals a value
+type Options struct {
+	// Alg is the algorithm to seal the value with, AlgAESGCM if empty
+	Alg string
+	// KeyID is recorded in the envelope so the key that sealed the value can be identified later
+	KeyID string
+	// Name, when not empty, binds the value to the tag name (the fil or env tag, or the field
+	// name for def tags) so it only decrypts when read for that same name
+	Name string
+	// KDF, when not nil, records the parameters used to derive the key from a passphrase
+	KDF *KDFParams
+	// Fingerprint records the fingerprint of the key in the envelope, see KeyFingerprint
+	Fingerprint bool
+	// NotBefore and NotAfter, when not zero, limits the period of time the value decrypts
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Encrypt takes a cleartext string and encrypts it into an enveloped ciphertext string
+// that can be decrypted again by Decrypt using the same key
+func Encrypt(bKey []byte, plaintext string) (string, error) {
+	return EncryptWithOptions(bKey, plaintext, Options{})
+}
+
+// EncryptWithKeyID works as Encrypt but records keyID in the envelope so
+// the key that sealed the value can be identified later
+func EncryptWithKeyID(bKey []byte, keyID string, plaintext string) (string, error) {
+	return EncryptWithOptions(bKey, plaintext, Options{KeyID: keyID})
+}
+
+// EncryptWithOptions works as Encrypt with the envelope controlled by opts
+func EncryptWithOptions(bKey []byte, plaintext string, opts Options) (string, error) {
+	alg := opts.Alg
+	if alg == "" {
+		alg = AlgAESGCM
+	}
+	if alg != AlgAESGCM && alg != AlgXChaCha20Poly1305 {
+		return "", fmt.Errorf("%w algorithm %s", ErrUnsupported, alg)
+	}
+	e := newEnvelope(alg, opts)
+	if opts.Fingerprint {
+		e.ext = append(e.ext, extFP+"="+KeyFingerprint(bKey))
+	}
+	return e.seal(bKey, plaintext, opts.Name)
+}
+
+// Returns the envelope for a value sealed with the algorithm and options
+func newEnvelope(alg string, opts Options) Envelope {
+	e := Envelope{Version: envelopeV1, Alg: alg, KeyID: opts.KeyID}
+	if opts.KDF != nil {
+		e.ext = append(e.ext, extKDF+"="+opts.KDF.String())
+	}
+	if opts.Name != "" {
+		e.ext = append(e.ext, extAAD+"="+extAADName)
+	}
+	e.ext = append(e.ext, timeExt(opts)...)
+	return e
+}
+
+// Returns true if the value is bracketed with paranthesis () marking it as cleartext
+func isCleartext(value string) bool {
+	return len(value) > 1 && value[0:1] == "(" && value[len(value)-1:] == ")"
+}
+
+// Decrypt takes an enveloped or legacy base64 encoded ciphertext string and decrypts it
+// into a cleartext string
+// If value string is bracketed with paranthesis () then it should be treated as cleartext so
+// remove the paranthesises and return as is
+func Decrypt(bKey []byte, cipherB64 string) (string, error) {
+	return DecryptWithName(bKey, cipherB64, "")
+}
+
+// DecryptWithName works as Decrypt but values bound to a tag name, see Options, only
+// decrypts if name is the name they were bound to
+func DecryptWithName(bKey []byte, cipherB64 string, name string) (string, error) {
+	return decryptWithName(bKey, cipherB64, name, true)
+}
+
+// Works as DecryptWithName, checking the not before and expiry times of the envelope
+// only when checkTime is set
+func decryptWithName(bKey []byte, cipherB64 string, name string, checkTime bool) (string, error) {
+	// Cleartext?
+	if isCleartext(cipherB64) {
+		return cipherB64[1 : len(cipherB64)-1], nil
+	}
+	if IsEnvelope(cipherB64) {
+		e, payload, err := parseEnvelope(cipherB64)
+		if err != nil {
+			return "", err
+		}
+		plainText, err := e.open(bKey, payload, name)
+		if err != nil {
+			return "", err
+		}
+		// The times are only trusted once the header has been authenticated
+		if checkTime {
+			if err := e.checkTime(); err != nil {
+				return "", err
+			}
+		}
+		return plainText, nil
+	}
+	encryptData, err := base64.URLEncoding.DecodeString(cipherB64)
+	if err != nil {
+		return "", fmt.Errorf("%w %v", ErrBase64, err)
+	}
+	if err := checkZeroKey(bKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(bKey)
+	if err != nil {
+		return "", err
+	}
+	plainText, err := open(aead, encryptData, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w (key fingerprint %s)", err, KeyFingerprint(bKey))
+	}
+	return plainText, nil
+}
+
 //
 func setFieldValue(p interface{}, field string, value string) error {
 	var err error
@@ -128,6 +294,11 @@ func setFieldValue(p interface{}, field string, value string) error {
 	if !fld.IsValid() || !fld.CanSet() {
 		return fmt.Errorf("%w - field %s", ErrNotExported, field)
 	}
+	return setValue(fld, value)
+}
+
+// Sets the string, int64, float64 or bool value from its string form
+func setValue(fld reflect.Value, value string) error {
 	switch fld.Kind() {
 	case reflect.String:
 		fld.SetString(value)
@@ -143,32 +314,25 @@ func setFieldValue(p interface{}, field string, value string) error {
 			return fmt.Errorf("%w %v", ErrParse, err)
 		}
 		fld.SetFloat(f64)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w %v", ErrParse, err)
+		}
+		fld.SetBool(b)
 	default:
 		return fmt.Errorf("%w %s", ErrUnhandledType, fld.Kind())
 	}
 	return nil
 }
 
-//
-func setValueFromTag(p interface{}, tagType string, tagName string, value string) error {
-	var err error
-	if err = CheckParam(p); err != nil {
-		return err
-	}
-	// Iterate over the fields until the right one is found
-	for i := 0; i < reflect.ValueOf(p).Elem().NumField(); i++ {
-		tv, ok := reflect.ValueOf(p).Elem().Type().Field(i).Tag.Lookup(tagType)
-		if ok && tv == tagName {
-			fieldName := reflect.ValueOf(p).Elem().Type().Field(i).Name
-			setFieldValue(p, fieldName, value)
-			return nil
-		}
-	}
-	return nil
-}
-
 // SetFromEnv ...
 func SetFromEnv(p interface{}, bKey []byte) error {
+	return keyringOf(bKey).SetFromEnv(p)
+}
+
+// Sets the fields tagged with env from the environment, decrypting them with the keyring
+func setFromEnv(p interface{}, kr *Keyring) error {
 	var err error
 
 	if err = CheckParam(p); err != nil {
@@ -183,11 +347,15 @@ func SetFromEnv(p interface{}, bKey []byte) error {
 			if !ok {
 				continue
 			}
-			value, err = Decrypt(bKey, value)
+			value, err = kr.DecryptWithName(value, tv)
 			if err != nil {
 				return err
 			}
 			setFieldValue(p, fieldName, value)
+		} else if sub := nestedStruct(reflect.ValueOf(p).Elem(), i); sub != nil {
+			if err = setFromEnv(sub, kr); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -206,6 +374,11 @@ func CheckParam(p interface{}) error {
 
 // SetDefaults ...
 func SetDefaults(struc interface{}, bKey []byte) error {
+	return keyringOf(bKey).SetDefaults(struc)
+}
+
+// Sets the fields tagged with def to their default values, decrypting them with the keyring
+func setDefaults(struc interface{}, kr *Keyring) error {
 	var err error
 	if err = CheckParam(struc); err != nil {
 		return err
@@ -216,63 +389,67 @@ func SetDefaults(struc interface{}, bKey []byte) error {
 		fld := e.Type().Field(i)
 		value, ok := fld.Tag.Lookup(tagDefVal)
 		if ok {
-			if value, err = Decrypt(bKey, value); err != nil {
+			if value, err = kr.DecryptWithName(value, fld.Name); err != nil {
 				return err
 			}
 			if err = setFieldValue(struc, fld.Name, value); err != nil {
 				return err
 			}
+		} else if sub := nestedStruct(e, i); sub != nil {
+			if err = setDefaults(sub, kr); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-// ParseReaders parses data from one or more io.Readers.
+// ParseReaders parses data from one or more io.Readers, in the native format or
+// the format they are marked with by WithFormat.
 // First set the dafault values,
 // then apply values from the files,
+// then values from credential files (systemd credentials or Docker secrets),
 // finally set values from environment variables
+// The values are decrypted using the keys from GetKeyring
 func ParseReaders(struc interface{}, readers []io.Reader) error {
 	var err error
 	if err = CheckParam(struc); err != nil {
 		return err
 	}
-	bKey, err := GetKey()
+	kr, err := GetKeyring()
 	if err != nil {
 		return err
 	}
-	if err := SetDefaults(struc, bKey); err != nil {
+	defer kr.Wipe()
+	return parseReaders(struc, kr, readers)
+}
+
+// Parses the readers decrypting the values with the keyring
+func parseReaders(struc interface{}, kr *Keyring, readers []io.Reader) error {
+	var err error
+	if err = CheckParam(struc); err != nil {
+		return err
+	}
+	if err := setDefaults(struc, kr); err != nil {
 		return err
 	}
-	// Process all lines in each reader. As soon as one reader have had
+	// Process each reader in its format. As soon as one reader have had
 	// any values in it stop processing the rest of the readers.
-	processed := false
-	cnt := 0
 	for _, r := range readers {
-		cnt++
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			s := strings.TrimSpace(scanner.Text())
-			// Skip empty lines and comments
-			if s == "" || string(s[0]) == "#" {
-				continue
-			}
-			// Split line into key (the tag name) and value
-			ss := strings.SplitN(s, "=", 2)
-			if len(ss) < 2 {
-				return fmt.Errorf("%w, missing = at '%s'", ErrBadFileFormat, s)
-			}
-			// Decrypt the value
-			value, err := Decrypt(bKey, strings.TrimSpace(ss[1]))
-			if err != nil {
-				return err
-			}
-			// Set the value in the struct, using the tag name
-			if err := setValueFromTag(struc, tagFileVal, strings.TrimSpace(ss[0]), value); err != nil {
-				return err
-			}
-			processed = true
+		r, format := formatOf(r)
+		parse := parseNative
+		switch format {
+		case FormatJSON:
+			parse = parseJSON
+		case FormatYAML:
+			parse = parseYAML
+		case FormatTOML:
+			parse = parseTOML
+		case FormatDotenv:
+			parse = parseDotenv
 		}
-		if err := scanner.Err(); err != nil {
+		processed, err := parse(struc, kr, r)
+		if err != nil {
 			return err
 		}
 		// Stop scanning files as soon as the first usable file has been fully processed
@@ -280,11 +457,92 @@ func ParseReaders(struc interface{}, readers []io.Reader) error {
 			break
 		}
 	}
-	// Finish with setting values from envronment variables
-	return SetFromEnv(struc, bKey)
+	// Then the credentials and finish with setting values from envronment variables
+	if err := setFromCredentials(struc, kr); err != nil {
+		return err
+	}
+	return setFromEnv(struc, kr)
+}
+
+// Parses the key = value lines of the reader, returning true if it had any values.
+// Keys following a [section] header are named section.key, setting the field tagged
+// with the key in the nested struct tagged with the section or the field tagged with
+// the dotted name. An empty [] header ends the section.
+func parseNative(struc interface{}, kr *Keyring, r io.Reader) (bool, error) {
+	processed := false
+	// Values are decrypted by the data key once a data key header has been seen
+	fileKr := kr
+	defer func() {
+		if fileKr != kr {
+			fileKr.Wipe()
+		}
+	}()
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		if IsDataKeyHeader(s) {
+			dkr, err := headerKeyring(kr, fileKr, s)
+			if err != nil {
+				return false, err
+			}
+			fileKr = dkr
+			continue
+		}
+		// Skip empty lines and comments
+		if s == "" || string(s[0]) == "#" {
+			continue
+		}
+		// The keys following a [section] header are prefixed by the section
+		if name, ok := sectionHeader(s); ok {
+			section = name
+			continue
+		}
+		// Split line into key (the tag name) and value
+		ss := strings.SplitN(s, "=", 2)
+		if len(ss) < 2 {
+			return false, fmt.Errorf("%w, missing = at '%s'", ErrBadFileFormat, s)
+		}
+		name := sectionKey(section, strings.TrimSpace(ss[0]))
+		// Decrypt the value, bound values are bound to the tag name
+		value, err := fileKr.DecryptWithName(strings.TrimSpace(ss[1]), name)
+		if err != nil {
+			return false, err
+		}
+		// Set the value in the struct, using the tag name or the dotted path of
+		// tags into nested structs
+		err = walkPath(reflect.ValueOf(struc).Elem(), name, func(fld reflect.Value) error {
+			return setValue(fld, value)
+		})
+		if err != nil {
+			return false, fmt.Errorf("%w at '%s'", err, name)
+		}
+		processed = true
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return processed, nil
+}
+
+// Returns the name of the section if the line is a [section] header
+func sectionHeader(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(s[1 : len(s)-1]), true
+}
+
+// Returns the name of the key in the section
+func sectionKey(section string, key string) string {
+	if section == "" {
+		return key
+	}
+	return section + "." + key
 }
 
 // ParseFiles tries to parse each file in the list and stops after the first parseable file.
+// The format of each file is given by its extension, see FormatOf.
 func ParseFiles(struc interface{}, filenames ...string) error {
 	var err error
 
@@ -293,15 +551,28 @@ func ParseFiles(struc interface{}, filenames ...string) error {
 	}
 
 	// Opens all specified files...
+	rdrs, closeAll := openFiles(filenames)
+	defer closeAll()
+	// ...and pass the readers into the ParseReaders() for processing
+	return ParseReaders(struc, rdrs)
+}
+
+// Opens the files that exists and returns them as readers, in the format given by
+// their extension, together with a function closing them all
+func openFiles(filenames []string) ([]io.Reader, func()) {
 	var rdrs []io.Reader
+	var files []*os.File
 	for _, filename := range filenames {
 		f, err := os.Open(filename)
 		if err != nil {
 			continue
 		}
-		defer f.Close()
-		rdrs = append(rdrs, f)
+		files = append(files, f)
+		rdrs = append(rdrs, WithFormat(f, FormatOf(filename)))
+	}
+	return rdrs, func() {
+		for _, f := range files {
+			f.Close()
+		}
 	}
-	// ...and pass the readers into the ParseReaders() for processing
-	return ParseReaders(struc, rdrs)
 }
@@ -0,0 +1,256 @@
+package cryco
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A KeyProvider decides where the keys come from. The package level functions
+// like GetKeyring and ParseReaders use DefaultKeyProvider, which reads the
+// environment and the variables patched in during build, while the With
+// variants of the parse functions takes any provider so keys can be sourced
+// from wherever the platform stores them, or be fixed keys in tests.
+
+// KeyProvider supplies keys, in order of preference so the first key is the primary key.
+// A provider with nothing configured returns no keys rather than an error. The returned
+// keys belong to the caller, who may wipe them.
+type KeyProvider interface {
+	Keys() ([]Key, error)
+}
+
+// Implemented by the providers of keys derived from a passphrase, returning the passphrase
+// of each key, or nil, so that the keyring can derive the key again for values sealed
+// using other parameters
+type passphraseProvider interface {
+	passphraseKeys() ([]Key, []*passphraseKey, error)
+}
+
+// Returns the keys of the provider together with their passphrases
+func providerKeys(p KeyProvider) ([]Key, []*passphraseKey, error) {
+	if pp, ok := p.(passphraseProvider); ok {
+		return pp.passphraseKeys()
+	}
+	ks, err := p.Keys()
+	return ks, make([]*passphraseKey, len(ks)), err
+}
+
+// EnvProvider takes the keys from the environment variables named after KEY<Name>, the
+// sources listed at DefaultKeyProvider up to and including the passphrase, with Name in
+// place of the executable name. An empty Name means the name of the running executable.
+type EnvProvider struct {
+	Name string
+}
+
+// Keys returns the keys found in the environment
+func (p EnvProvider) Keys() ([]Key, error) {
+	ks, _, err := p.passphraseKeys()
+	return ks, err
+}
+
+// Returns the keys found in the environment and the passphrase of the derived key
+func (p EnvProvider) passphraseKeys() ([]Key, []*passphraseKey, error) {
+	name := p.Name
+	if name == "" {
+		var err error
+		if name, err = exeName(); err != nil {
+			return nil, nil, err
+		}
+	}
+	var keys []Key
+	// The keys read before an error are wiped
+	fail := func(err error) ([]Key, []*passphraseKey, error) {
+		wipeKeys(keys)
+		return nil, nil, err
+	}
+	for i := 0; ; i++ {
+		envName := "KEY" + name
+		if i > 0 {
+			envName += "_" + strconv.Itoa(i)
+		}
+		s := os.Getenv(envName)
+		if s == "" && i > 0 {
+			break
+		}
+		ks, err := ParseKeys(s)
+		if err != nil {
+			return fail(err)
+		}
+		keys = append(keys, ks...)
+		if i == 0 {
+			if ks, err = keyFilesFromEnv(name); err != nil {
+				return fail(err)
+			}
+			keys = append(keys, ks...)
+			if ks, err = kmsKeysFromEnv(name); err != nil {
+				return fail(err)
+			}
+			keys = append(keys, ks...)
+			if ks, err = sharesFromEnv(name); err != nil {
+				return fail(err)
+			}
+			keys = append(keys, ks...)
+		}
+	}
+	pks := make([]*passphraseKey, len(keys))
+	k, pk, err := passphraseKeyFromEnv(name)
+	if err != nil {
+		return fail(err)
+	}
+	if pk != nil {
+		keys = append(keys, k)
+		pks = append(pks, pk)
+	}
+	return keys, pks, nil
+}
+
+// LdflagsProvider takes the keys from the key and keys variables patched into the
+// executable during build with go build -ldflags "-X github.com/mengstr/cryco.key=..."
+type LdflagsProvider struct{}
+
+// Keys returns the keys patched into the executable
+func (LdflagsProvider) Keys() ([]Key, error) {
+	return ParseKeys(key + "," + keys)
+}
+
+// FileProvider reads the keys from a file holding a list of keys as accepted by
+// ParseKeys, the keys separated by commas or newlines. The file is refused if
+// others than its owner and group have access to it, see OpenKeyFile.
+type FileProvider struct {
+	Path string
+}
+
+// Keys returns the keys read from the file
+func (p FileProvider) Keys() ([]Key, error) {
+	f, err := OpenKeyFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readKeys(f)
+}
+
+// Reads a list of keys separated by commas or newlines
+func readKeys(r io.Reader) ([]Key, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	return ParseKeys(strings.Join(strings.Fields(string(data)), ","))
+}
+
+// StaticProvider is a fixed list of keys
+type StaticProvider []Key
+
+// Keys returns copies of the keys in the list
+func (p StaticProvider) Keys() ([]Key, error) {
+	return copyKeys(p), nil
+}
+
+// Returns copies of the keys, not sharing their bytes
+func copyKeys(ks []Key) []Key {
+	cs := make([]Key, len(ks))
+	for i, k := range ks {
+		cs[i] = Key{ID: k.ID, Bytes: append([]byte(nil), k.Bytes...)}
+	}
+	return cs
+}
+
+// ChainProvider returns the keys of all its providers in order, so the primary key
+// is the first key of the first provider having any keys
+type ChainProvider []KeyProvider
+
+// Keys returns the keys of all providers, stopping at the first error
+func (c ChainProvider) Keys() ([]Key, error) {
+	ks, _, err := c.passphraseKeys()
+	return ks, err
+}
+
+// Returns the keys of all providers together with their passphrases
+func (c ChainProvider) passphraseKeys() ([]Key, []*passphraseKey, error) {
+	var keys []Key
+	var pks []*passphraseKey
+	for _, p := range c {
+		ks, ps, err := providerKeys(p)
+		if err != nil {
+			wipeKeys(keys)
+			return nil, nil, err
+		}
+		keys = append(keys, ks...)
+		pks = append(pks, ps...)
+	}
+	return keys, pks, nil
+}
+
+// Chain returns a provider returning the keys of all the providers in order
+func Chain(providers ...KeyProvider) KeyProvider {
+	return ChainProvider(providers)
+}
+
+// DefaultKeyProvider returns the provider used by GetKey, GetKeyring and the package level
+// parse functions, the environment of the executable followed by its credential and the
+// build time variables. The keys are taken, in order, from
+//   - the environment variable KEY<executable name>
+//   - the key file named by KEY<executable name>_FILE
+//   - the file descriptor in KEY<executable name>_FD
+//   - the key in KEY<executable name>_WRAPPED unwrapped by the key service at
+//     KEY<executable name>_KMS_URL
+//   - the key combined from the shares in KEY<executable name>_SHARES and
+//     KEY<executable name>_SHARE_FILES
+//   - the numbered environment variables KEY<executable name>_1, KEY<executable name>_2
+//     and so on up to the first one missing
+//   - the passphrase and salt in KEY<executable name>_PASSPHRASE and KEY<executable name>_SALT
+//   - the systemd credential or Docker secret KEY<executable name>
+//   - the key and keys variables patched into the executable during build
+//
+// Each of them may hold a list of keys as accepted by ParseKeys.
+func DefaultKeyProvider() KeyProvider {
+	return Chain(EnvProvider{}, CredentialProvider{}, LdflagsProvider{})
+}
+
+// NewKeyringFrom returns a keyring holding the keys from the provider. The keyring
+// is empty if the provider has no keys. The keys returned by the provider are wiped
+// once the keyring holds its copies.
+func NewKeyringFrom(p KeyProvider) (*Keyring, error) {
+	ks, pks, err := providerKeys(p)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKeys(ks)
+	kr := &Keyring{}
+	for i, k := range ks {
+		if err := kr.add(k, pks[i]); err != nil {
+			kr.Wipe()
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// ParseReadersWith works as ParseReaders but decrypts the values using the keys from the provider
+func ParseReadersWith(p KeyProvider, struc interface{}, readers []io.Reader) error {
+	if err := CheckParam(struc); err != nil {
+		return err
+	}
+	kr, err := NewKeyringFrom(p)
+	if err != nil {
+		return err
+	}
+	defer kr.Wipe()
+	return parseReaders(struc, kr, readers)
+}
+
+// ParseFilesWith works as ParseFiles but decrypts the values using the keys from the provider
+func ParseFilesWith(p KeyProvider, struc interface{}, filenames ...string) error {
+	if err := CheckParam(struc); err != nil {
+		return err
+	}
+	kr, err := NewKeyringFrom(p)
+	if err != nil {
+		return err
+	}
+	defer kr.Wipe()
+	return kr.ParseFiles(struc, filenames...)
+}
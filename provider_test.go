@@ -0,0 +1,149 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvProvider(t *testing.T) {
+	os.Setenv("KEYcrycoprov", "a:"+keyGoodB64)
+	os.Setenv("KEYcrycoprov_1", "b:"+key256B64)
+	os.Setenv("KEYcrycobad", keyBadB64)
+	defer os.Unsetenv("KEYcrycoprov")
+	defer os.Unsetenv("KEYcrycoprov_1")
+	defer os.Unsetenv("KEYcrycobad")
+
+	tests := []struct {
+		name        string
+		p           KeyProvider
+		want        []Key
+		wantErr     bool
+		wantErrType error
+	}{
+		{"keys", EnvProvider{Name: "crycoprov"}, []Key{{ID: "a", Bytes: bKeyGood}, {ID: "b", Bytes: bKey256}}, false, nil},
+		{"nothing", EnvProvider{Name: "crycononexisting"}, nil, false, nil},
+		{"bad key", EnvProvider{Name: "crycobad"}, nil, true, ErrBase64},
+		{"ldflags", LdflagsProvider{}, nil, false, nil},
+		{"static", StaticProvider{{ID: "s", Bytes: bKey192}}, []Key{{ID: "s", Bytes: bKey192}}, false, nil},
+		{"chain", Chain(StaticProvider{{ID: "s", Bytes: bKey192}}, EnvProvider{Name: "crycoprov"}),
+			[]Key{{ID: "s", Bytes: bKey192}, {ID: "a", Bytes: bKeyGood}, {ID: "b", Bytes: bKey256}}, false, nil},
+		{"chain error", Chain(StaticProvider{{ID: "s", Bytes: bKey192}}, EnvProvider{Name: "crycobad"}), nil, true, ErrBase64},
+		{"empty chain", Chain(), nil, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.Keys()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Keys() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "keys")
+
+	tests := []struct {
+		name        string
+		content     string
+		want        []Key
+		wantErr     bool
+		wantErrType error
+	}{
+		{"one", keyGoodB64 + "\n", []Key{{ID: "", Bytes: bKeyGood}}, false, nil},
+		{"lines", "new:" + key256B64 + "\r\nold:" + keyGoodB64 + "\n", []Key{{ID: "new", Bytes: bKey256}, {ID: "old", Bytes: bKeyGood}}, false, nil},
+		{"commas", "new:" + key256B64 + ",old:" + keyGoodB64, []Key{{ID: "new", Bytes: bKey256}, {ID: "old", Bytes: bKeyGood}}, false, nil},
+		{"empty", "", nil, false, nil},
+		{"bad key", keyBadB64, nil, true, ErrBase64},
+		{"missing", "-", nil, true, ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filename)
+			if tt.content != "-" {
+				if err := ioutil.WriteFile(filename, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := FileProvider{Path: filename}.Keys()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Keys() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReadersWith(t *testing.T) {
+	type testStruct struct {
+		I int64  `def:"(1)" fil:"I"`
+		S string `fil:"S"`
+	}
+	kr, _ := NewKeyring(Key{ID: "test", Bytes: bKey256})
+	sealedS, _ := kr.Encrypt("secret")
+	cfg := "I = " + cipher5 + "\nS = " + sealedS + "\n"
+
+	tests := []struct {
+		name        string
+		p           KeyProvider
+		wantI       int64
+		wantS       string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"static", StaticProvider{{ID: "test", Bytes: bKey256}, {ID: "good", Bytes: bKeyGood}}, 5, "secret", false, nil},
+		{"wrong key", StaticProvider{{Bytes: bKeyWrong}}, 0, "", true, ErrInvalidKey},
+		{"no keys", StaticProvider{}, 0, "", true, ErrInvalidKey},
+		{"bad key size", StaticProvider{{Bytes: bKeyShort}}, 0, "", true, ErrKeySize},
+		{"duplicate id", StaticProvider{{ID: "a", Bytes: bKeyGood}, {ID: "a", Bytes: bKey256}}, 0, "", true, ErrKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s testStruct
+			err := ParseReadersWith(tt.p, &s, []io.Reader{strings.NewReader(cfg)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReadersWith() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("ParseReadersWith() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if s.I != tt.wantI || s.S != tt.wantS {
+				t.Errorf("ParseReadersWith() = %+v, want %v %v", s, tt.wantI, tt.wantS)
+			}
+		})
+	}
+}
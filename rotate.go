@@ -0,0 +1,126 @@
+package cryco
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Rotate reads a file in the key = value format understood by ParseReaders from r and
+// writes it to w with every encrypted value decrypted using oldKeys and encrypted again
+// using the primary key of newKeys. Comments, blank lines, the ordering and formatting of
+// the lines, [section] headers and (cleartext) values are kept as is. Values bound to their
+// tag name, section.key in a section, stay bound. Values sealed with XChaCha20-Poly1305
+// keep using it. Values sealed to an X25519 public key are sealed to the public key of the
+// primary key of newKeys, which must then be a 32 byte X25519 private key, and other values
+// use AES-GCM. Values recording the fingerprint of their key record the fingerprint of
+// the new key. Not before and expiry times are kept, and values outside them are rotated
+// as well. A data key header line is rewrapped using the new key while the values
+// encrypted by the data key are kept as is, since the data key itself doesn't change.
+// Returns the number of values, and data key headers, that were re-encrypted.
+func Rotate(w io.Writer, r io.Reader, oldKeys *Keyring, newKeys *Keyring) (int, error) {
+	cnt := 0
+	br := bufio.NewReader(r)
+	dataKeyed := false
+	section := ""
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return cnt, err
+		}
+		if IsDataKeyHeader(line) {
+			dek, err := UnwrapDataKey(oldKeys, line)
+			if err != nil {
+				return cnt, err
+			}
+			header, err := wrapDataKey(newKeys, dek)
+			Wipe(dek)
+			if err != nil {
+				return cnt, err
+			}
+			// Keep the line ending and leading whitespace
+			s := strings.TrimSpace(line)
+			line = strings.Replace(line, s, header, 1)
+			cnt++
+			dataKeyed = true
+			if _, err := io.WriteString(w, line); err != nil {
+				return cnt, err
+			}
+		} else if name, ok := sectionHeader(strings.TrimSpace(line)); ok {
+			section = name
+			if _, err := io.WriteString(w, line); err != nil {
+				return cnt, err
+			}
+		} else if line != "" {
+			rotated, changed, err := rotateLine(line, section, oldKeys, newKeys, dataKeyed)
+			if err != nil {
+				return cnt, err
+			}
+			if changed {
+				cnt++
+			}
+			if _, err := io.WriteString(w, rotated); err != nil {
+				return cnt, err
+			}
+		}
+		if err == io.EOF {
+			return cnt, nil
+		}
+	}
+}
+
+// Re-encrypts the value in a single line of the section, returning the line and if it was
+// changed. Values encrypted by the data key are kept when dataKeyed is set.
+func rotateLine(line string, section string, oldKeys *Keyring, newKeys *Keyring, dataKeyed bool) (string, bool, error) {
+	s := strings.TrimSpace(line)
+	// Keep empty lines and comments
+	if s == "" || string(s[0]) == "#" {
+		return line, false, nil
+	}
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", false, fmt.Errorf("%w, missing = at '%s'", ErrBadFileFormat, s)
+	}
+	// Locate the value, keeping the whitespace around it
+	rest := line[i+1:]
+	value := strings.TrimSpace(rest)
+	if value == "" || isCleartext(value) {
+		return line, false, nil
+	}
+	start := i + 1 + strings.Index(rest, value)
+	name := sectionKey(section, strings.TrimSpace(line[:i]))
+	if e, err := ParseEnvelope(value); dataKeyed && err == nil && e.KeyID == DataKeyID {
+		return line, false, nil
+	}
+
+	// Values that are expired or not yet valid are rotated as well, keeping their times
+	plaintext, err := oldKeys.decryptWithName(value, name, false)
+	if err != nil {
+		return "", false, fmt.Errorf("%w at '%s'", err, name)
+	}
+	var opts Options
+	if e, err := ParseEnvelope(value); err == nil {
+		if e.Bound() {
+			opts.Name = name
+		}
+		if e.Alg == AlgXChaCha20Poly1305 || e.Alg == AlgX25519 {
+			opts.Alg = e.Alg
+		}
+		opts.Fingerprint = e.Fingerprint() != ""
+		opts.NotBefore, _ = e.NotBefore()
+		opts.NotAfter, _ = e.NotAfter()
+	}
+	var sealed string
+	if opts.Alg == AlgX25519 {
+		// Sealed again to the public key of the new private key
+		opts.Alg = ""
+		sealed, err = newKeys.encryptToPrimary(plaintext, opts)
+	} else {
+		sealed, err = newKeys.EncryptWithOptions(plaintext, opts)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("%w at '%s'", err, name)
+	}
+	return line[:start] + sealed + line[start+len(value):], true, nil
+}
@@ -0,0 +1,199 @@
+package cryco
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBound(t *testing.T) {
+	krOld, _ := NewKeyring(Key{"old", bKeyGood})
+	krNew, _ := NewKeyring(Key{"new", bKey256})
+	bound, _ := krOld.EncryptWithOptions("s3cret", Options{Name: "DB_PASSWORD"})
+
+	var w bytes.Buffer
+	if _, err := Rotate(&w, strings.NewReader("DB_PASSWORD = "+bound+"\n"), krOld, krNew); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(w.String(), "DB_PASSWORD = "))
+	if e, err := ParseEnvelope(value); err != nil || !e.Bound() || e.KeyID != "new" {
+		t.Errorf("Rotate() = %v, want value bound and sealed by new key", value)
+	}
+	if got, err := krNew.DecryptWithName(value, "DB_PASSWORD"); err != nil || got != "s3cret" {
+		t.Errorf("Rotate() value decrypts to %v %v", got, err)
+	}
+	if _, err := krNew.DecryptWithName(value, "API_URL"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Rotate() value decrypts for another name")
+	}
+}
+
+func TestRotateAlg(t *testing.T) {
+	krOld, _ := NewKeyring(Key{ID: "old", Bytes: bKey256})
+	krNew, _ := NewKeyring(Key{"new", bKey256})
+	xchacha, _ := krOld.EncryptWithOptions("fast", Options{Alg: AlgXChaCha20Poly1305})
+	aesgcm, _ := krOld.Encrypt("aes")
+
+	var w bytes.Buffer
+	if _, err := Rotate(&w, strings.NewReader("X="+xchacha+"\nA="+aesgcm+"\n"), krOld, krNew); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	lines := strings.Split(w.String(), "\n")
+	for i, want := range []string{AlgXChaCha20Poly1305, AlgAESGCM} {
+		e, err := ParseEnvelope(lines[i][2:])
+		if err != nil || e.Alg != want || e.KeyID != "new" {
+			t.Errorf("Rotate() line %d = %v %v, want algorithm %v", i, e, err, want)
+		}
+	}
+}
+
+func TestRotateX25519(t *testing.T) {
+	oldPriv, oldPub, _ := GenerateKeyPair()
+	newPriv, _, _ := GenerateKeyPair()
+	krOld, _ := NewKeyring(Key{"old", oldPriv})
+	krNew, _ := NewKeyring(Key{"new", newPriv})
+	sealed, _ := EncryptTo(oldPub, "s3cret", Options{KeyID: "old", Name: "DB_PASSWORD", Fingerprint: true})
+
+	var w bytes.Buffer
+	if _, err := Rotate(&w, strings.NewReader("DB_PASSWORD="+sealed+"\n"), krOld, krNew); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(w.String(), "DB_PASSWORD="))
+	e, err := ParseEnvelope(value)
+	if err != nil || e.Alg != AlgX25519 || e.KeyID != "new" || !e.Bound() || e.Fingerprint() != fingerprintFor(AlgX25519, newPriv) {
+		t.Errorf("Rotate() = %v, want x25519 value sealed to the new key", value)
+	}
+	if got, err := krNew.DecryptWithName(value, "DB_PASSWORD"); err != nil || got != "s3cret" {
+		t.Errorf("Rotate() value decrypts to %v %v", got, err)
+	}
+	if _, err := krOld.DecryptWithName(value, "DB_PASSWORD"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Rotate() value decrypts with the old key")
+	}
+
+	// The public key mode can't be kept with a new key that isn't an X25519 private key
+	krAES, _ := NewKeyring(Key{"new", bKeyGood})
+	if _, err := Rotate(&w, strings.NewReader("DB_PASSWORD="+sealed+"\n"), krOld, krAES); !errors.Is(err, ErrKeySize) {
+		t.Errorf("Rotate() error = %v, want %v", err, ErrKeySize)
+	}
+}
+
+func TestRotateExpired(t *testing.T) {
+	t0 := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return t0 })
+	defer SetClock(nil)
+	krOld, _ := NewKeyring(Key{"old", bKeyGood})
+	krNew, _ := NewKeyring(Key{"new", bKey256})
+	expired, _ := krOld.EncryptWithOptions("old", Options{NotAfter: t0.Add(-time.Hour)})
+	future, _ := krOld.EncryptWithOptions("future", Options{NotBefore: t0.Add(time.Hour)})
+	valid, _ := krOld.Encrypt("valid")
+
+	// Values outside their times are rotated along with the others, keeping the times
+	var w bytes.Buffer
+	cnt, err := Rotate(&w, strings.NewReader("E="+expired+"\nF="+future+"\nV="+valid+"\n"), krOld, krNew)
+	if err != nil || cnt != 3 {
+		t.Fatalf("Rotate() = %v %v, want 3", cnt, err)
+	}
+	lines := strings.Split(w.String(), "\n")
+	e, _ := ParseEnvelope(lines[0][2:])
+	if exp, ok := e.NotAfter(); e.KeyID != "new" || !ok || !exp.Equal(t0.Add(-time.Hour)) {
+		t.Errorf("Rotate() = %v, want expiry kept", lines[0])
+	}
+	if _, err := krNew.Decrypt(lines[0][2:]); !errors.Is(err, ErrExpired) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrExpired)
+	}
+	if _, err := krNew.Decrypt(lines[1][2:]); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrNotYetValid)
+	}
+	SetClock(func() time.Time { return t0.Add(2 * time.Hour) })
+	if got, err := krNew.Decrypt(lines[1][2:]); err != nil || got != "future" {
+		t.Errorf("Decrypt() = %v %v, want future", got, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	krOld, _ := NewKeyring(Key{"old", bKeyGood})
+	krNew, _ := NewKeyring(Key{ID: "new", Bytes: bKey256})
+	sealedS, _ := krOld.Encrypt("Three")
+
+	cfg := "\n#\n# Hello world\n\nI = " + cipher5 + "  \r\nF=(3.3)\n  S=\t" + sealedS + "\nE=\n# Last line without newline"
+	tests := []struct {
+		name        string
+		cfg         string
+		oldKeys     *Keyring
+		wantCnt     int
+		wantErr     bool
+		wantErrType error
+	}{
+		{"good", cfg, krOld, 2, false, nil},
+		{"empty", "", krOld, 0, false, nil},
+		{"wrong key", cfg, krNew, 0, true, ErrInvalidKey},
+		{"missing =", "I (5)\n", krOld, 0, true, ErrBadFileFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w bytes.Buffer
+			got, err := Rotate(&w, strings.NewReader(tt.cfg), tt.oldKeys, krNew)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Rotate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("Rotate() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got != tt.wantCnt {
+				t.Errorf("Rotate() = %v, want %v", got, tt.wantCnt)
+			}
+			inLines := strings.Split(tt.cfg, "\n")
+			outLines := strings.Split(w.String(), "\n")
+			if len(inLines) != len(outLines) {
+				t.Fatalf("Rotate() got %d lines, want %d", len(outLines), len(inLines))
+			}
+			for i := range inLines {
+				in, out := inLines[i], outLines[i]
+				if in == out {
+					continue
+				}
+				// Only the value may differ, the rest of the line must be kept
+				j := strings.Index(in, "=")
+				prefix := in[:j+1] + in[j+1:len(in)-len(strings.TrimLeft(in[j+1:], " \t"))]
+				suffix := in[len(strings.TrimRight(in, " \t\r")):]
+				if !strings.HasPrefix(out, prefix) || !strings.HasSuffix(out, suffix) {
+					t.Errorf("Rotate() line %q changed into %q", in, out)
+				}
+				value := strings.TrimSpace(out[j+1:])
+				if _, err := krOld.Decrypt(value); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Rotate() line %q still decrypts with the old key", out)
+				}
+				plain, err := krNew.Decrypt(value)
+				want, _ := krOld.Decrypt(strings.TrimSpace(in[j+1:]))
+				if err != nil || plain != want {
+					t.Errorf("Rotate() line %q decrypts to %q %v, want %q", out, plain, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateSections(t *testing.T) {
+	krOld, _ := NewKeyring(Key{ID: "old", Bytes: bKeyGood})
+	krNew, _ := NewKeyring(Key{ID: "new", Bytes: bKey256})
+	bound, _ := krOld.EncryptWithOptions("s3cret", Options{Name: "db.password"})
+
+	var w bytes.Buffer
+	cnt, err := Rotate(&w, strings.NewReader("[db]\npassword = "+bound+"\n"), krOld, krNew)
+	if err != nil || cnt != 1 {
+		t.Fatalf("Rotate() = %v %v", cnt, err)
+	}
+	lines := strings.Split(w.String(), "\n")
+	value := strings.TrimPrefix(lines[1], "password = ")
+	if lines[0] != "[db]" {
+		t.Errorf("Rotate() header = %v", lines[0])
+	}
+	if got, err := krNew.DecryptWithName(value, "db.password"); err != nil || got != "s3cret" {
+		t.Errorf("Rotate() value decrypts to %v %v", got, err)
+	}
+}
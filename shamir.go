@@ -0,0 +1,188 @@
+package cryco
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mengstr/cryco/keyenc"
+)
+
+// A key can be split into N shares using Shamir's secret sharing so that any K
+// of them recreates the key while fewer than K reveals nothing about it. Each
+// byte of the key is the constant term of its own random polynomial of degree
+// K-1 over GF(256), and share x holds the values of the polynomials at x. A
+// share is the x coordinate byte followed by one byte per key byte, encoded
+// like keys using keyenc. Nothing in the shares tells if the right ones were
+// combined, too few or mismatched shares just gives a key that won't decrypt.
+
+var (
+	// ErrShare The key shares are malformed, too few or don't belong together
+	ErrShare = errors.New("Invalid key share")
+)
+
+// SplitKey splits the key into n shares of which any k recreates the key
+func SplitKey(bKey []byte, n int, k int) ([]string, error) {
+	if k < 2 || n < k || n > 255 {
+		return nil, fmt.Errorf("%w, need 2 <= k <= n <= 255 (n=%d, k=%d)", ErrShare, n, k)
+	}
+	if len(bKey) == 0 {
+		return nil, fmt.Errorf("%w, empty key", ErrShare)
+	}
+	coef := make([]byte, k)
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(bKey)+1)
+		shares[i][0] = byte(i + 1)
+	}
+	for j, b := range bKey {
+		coef[0] = b
+		if _, err := io.ReadFull(rand.Reader, coef[1:]); err != nil {
+			return nil, fmt.Errorf("%w %v", ErrInternal, err)
+		}
+		for _, share := range shares {
+			share[j+1] = gfEval(coef, share[0])
+		}
+	}
+	for i := range coef {
+		coef[i] = 0
+	}
+	encoded := make([]string, n)
+	for i, share := range shares {
+		encoded[i] = keyenc.Encode(share)
+	}
+	return encoded, nil
+}
+
+// CombineShares recreates the key from at least k of the shares created by SplitKey
+func CombineShares(shares []string) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("%w, need at least 2 shares", ErrShare)
+	}
+	xs := make([]byte, len(shares))
+	ys := make([][]byte, len(shares))
+	// The decoded shares are wiped once combined
+	defer func() {
+		for _, y := range ys {
+			Wipe(y)
+		}
+	}()
+	seen := map[byte]bool{}
+	for i, s := range shares {
+		b, err := keyenc.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w %v", ErrBase64, err)
+		}
+		if len(b) < 2 || (i > 0 && len(b) != len(ys[0])+1) {
+			Wipe(b)
+			return nil, fmt.Errorf("%w, share %d has the wrong length", ErrShare, i+1)
+		}
+		if b[0] == 0 || seen[b[0]] {
+			Wipe(b)
+			return nil, fmt.Errorf("%w, share %d is bad or a duplicate", ErrShare, i+1)
+		}
+		seen[b[0]] = true
+		xs[i], ys[i] = b[0], b[1:]
+	}
+	// Lagrange interpolation at x=0
+	bKey := make([]byte, len(ys[0]))
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i != j {
+				basis = gfMul(basis, gfMul(xs[j], gfInv(xs[i]^xs[j])))
+			}
+		}
+		for b := range bKey {
+			bKey[b] ^= gfMul(ys[i][b], basis)
+		}
+	}
+	return bKey, nil
+}
+
+// Evaluates the polynomial with the coefficients, lowest degree first, at x
+func gfEval(coef []byte, x byte) byte {
+	var y byte
+	for i := len(coef) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coef[i]
+	}
+	return y
+}
+
+// Multiplies in GF(256) using the AES polynomial, without data dependent branches
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ -(a>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+// Returns the multiplicative inverse in GF(256) as a^254
+func gfInv(a byte) byte {
+	r := a
+	for i := 0; i < 6; i++ {
+		r = gfMul(gfMul(r, r), a)
+	}
+	return gfMul(r, r)
+}
+
+// SharesProvider recreates a key from key shares, given directly or read from files
+// holding one share each. The key files are checked as in FileProvider.
+type SharesProvider struct {
+	Shares []string // Shares as created by SplitKey
+	Files  []string // Files holding one share each
+	ID     string   // Optional ID of the key
+}
+
+// Keys returns the key combined from the shares, or no key if there are no shares
+func (p SharesProvider) Keys() ([]Key, error) {
+	shares := append([]string(nil), p.Shares...)
+	for _, path := range p.Files {
+		f, err := OpenKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w %v", ErrInternal, err)
+		}
+		shares = append(shares, string(data))
+	}
+	if len(shares) == 0 {
+		return nil, nil
+	}
+	bKey, err := CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	if !ValidKeySize(len(bKey)) {
+		Wipe(bKey)
+		return nil, fmt.Errorf("%w %d", ErrKeySize, len(bKey))
+	}
+	return []Key{{ID: p.ID, Bytes: bKey}}, nil
+}
+
+// Returns the key combined from the comma separated shares in KEY<name>_SHARES and the
+// comma separated files holding one share each in KEY<name>_SHARE_FILES
+func sharesFromEnv(name string) ([]Key, error) {
+	split := func(s string) []string {
+		var ss []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				ss = append(ss, v)
+			}
+		}
+		return ss
+	}
+	return SharesProvider{
+		Shares: split(os.Getenv("KEY" + name + "_SHARES")),
+		Files:  split(os.Getenv("KEY" + name + "_SHARE_FILES")),
+	}.Keys()
+}
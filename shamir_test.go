@@ -0,0 +1,136 @@
+package cryco
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGfInv(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := gfMul(byte(a), gfInv(byte(a))); got != 1 {
+			t.Errorf("gfMul(%d, gfInv(%d)) = %d, want 1", a, a, got)
+		}
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         []byte
+		n           int
+		k           int
+		wantErr     bool
+		wantErrType error
+	}{
+		{"2 of 2", bKeyGood, 2, 2, false, nil},
+		{"3 of 5", bKey256, 5, 3, false, nil},
+		{"5 of 5", bKey192, 5, 5, false, nil},
+		{"255", bKeyGood, 255, 17, false, nil},
+		{"k too small", bKeyGood, 5, 1, true, ErrShare},
+		{"k larger than n", bKeyGood, 3, 4, true, ErrShare},
+		{"n too large", bKeyGood, 256, 3, true, ErrShare},
+		{"empty key", nil, 5, 3, true, ErrShare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := SplitKey(tt.key, tt.n, tt.k)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("SplitKey() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if len(shares) != tt.n {
+				t.Fatalf("SplitKey() = %d shares, want %d", len(shares), tt.n)
+			}
+			// Any k shares, here the last k ones, recreates the key, k-1 shares doesn't
+			if got, err := CombineShares(shares[tt.n-tt.k:]); err != nil || !bytes.Equal(got, tt.key) {
+				t.Errorf("CombineShares() = %v %v, want %v", got, err, tt.key)
+			}
+			if got, err := CombineShares(shares[:tt.n]); err != nil || !bytes.Equal(got, tt.key) {
+				t.Errorf("CombineShares() all = %v %v, want %v", got, err, tt.key)
+			}
+			if got, _ := CombineShares(shares[:tt.k-1]); tt.k > 2 && bytes.Equal(got, tt.key) {
+				t.Errorf("CombineShares() with %d shares recreated the key", tt.k-1)
+			}
+		})
+	}
+}
+
+func TestCombineShares(t *testing.T) {
+	shares, _ := SplitKey(bKeyGood, 3, 2)
+	other, _ := SplitKey(bKey256, 3, 2)
+	tests := []struct {
+		name        string
+		shares      []string
+		wantErrType error
+	}{
+		{"one share", shares[:1], ErrShare},
+		{"duplicate", []string{shares[0], shares[0]}, ErrShare},
+		{"mixed sizes", []string{shares[0], other[1]}, ErrShare},
+		{"zero x", []string{shares[0], "AAAA"}, ErrShare},
+		{"too short", []string{shares[0], "AQ=="}, ErrShare},
+		{"bad base64", []string{shares[0], badBase64}, ErrBase64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CombineShares(tt.shares); !errors.Is(err, tt.wantErrType) {
+				t.Errorf("CombineShares() error = '%v', wantErr '%v'", err, tt.wantErrType)
+			}
+		})
+	}
+}
+
+func TestSharesProvider(t *testing.T) {
+	shares, _ := SplitKey(bKey256, 5, 3)
+	short, _ := SplitKey([]byte("short"), 2, 2)
+	dir, err := ioutil.TempDir("", "cryco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file1, file2 := filepath.Join(dir, "share1"), filepath.Join(dir, "share2")
+	ioutil.WriteFile(file1, []byte(shares[1]+"\n"), 0600)
+	ioutil.WriteFile(file2, []byte(shares[2]+"\n"), 0644)
+	defer os.Unsetenv("KEYcrycoshares_SHARES")
+	defer os.Unsetenv("KEYcrycoshares_SHARE_FILES")
+
+	tests := []struct {
+		name        string
+		shares      string
+		files       string
+		want        []Key
+		wantErrType error
+	}{
+		{"env", shares[0] + ", " + shares[3] + "," + shares[4], "", []Key{{ID: "", Bytes: bKey256}}, nil},
+		{"env and file", shares[0] + "," + shares[3], file1, []Key{{ID: "", Bytes: bKey256}}, nil},
+		{"nothing", "", "", nil, nil},
+		{"world readable file", shares[0], file1 + "," + file2, nil, ErrKeyFilePerm},
+		{"missing file", shares[0], file1 + ".none", nil, ErrInternal},
+		{"bad key size", short[0] + "," + short[1], "", nil, ErrKeySize},
+		{"single share", shares[0], "", nil, ErrShare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KEYcrycoshares_SHARES", tt.shares)
+			os.Setenv("KEYcrycoshares_SHARE_FILES", tt.files)
+			got, err := EnvProvider{Name: "crycoshares"}.Keys()
+			if !errors.Is(err, tt.wantErrType) {
+				t.Errorf("Keys() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package cryco
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Without any key configured GetKey and GetKeyring falls back to the all-zero
+// key, so an application missing its key silently decrypts nothing but the
+// cleartext values. In strict mode, which will be the default in a future major
+// version, a missing key is the error ErrNoKey and the all-zero key is refused
+// when encrypting and decrypting. AllowInsecureZeroKey lifts the latter for
+// tests relying on the zero key.
+
+var (
+	// ErrNoKey No key is configured, or the all-zero key was used in strict mode
+	ErrNoKey = errors.New("No key")
+)
+
+var (
+	strict       atomic.Bool
+	allowZeroKey atomic.Bool
+)
+
+// SetStrict turns the strict mode on or off
+func SetStrict(on bool) {
+	strict.Store(on)
+}
+
+// Strict returns true if the strict mode is on
+func Strict() bool {
+	return strict.Load()
+}
+
+// AllowInsecureZeroKey makes the strict mode accept the all-zero key again, both as the
+// fallback when no key is configured and for encrypting and decrypting. Only meant for tests.
+func AllowInsecureZeroKey(allow bool) {
+	allowZeroKey.Store(allow)
+}
+
+// Returns true if the zero key may be used, always outside of the strict mode
+func zeroKeyAllowed() bool {
+	return !strict.Load() || allowZeroKey.Load()
+}
+
+// Returns ErrNoKey if the key is all zeros and the zero key isn't allowed
+func checkZeroKey(bKey []byte) error {
+	if zeroKeyAllowed() {
+		return nil
+	}
+	for _, b := range bKey {
+		if b != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, the all-zero key is refused in strict mode", ErrNoKey)
+}
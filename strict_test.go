@@ -0,0 +1,88 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	sealedZero, _ := Encrypt(bKeyZero, "zero")
+	sealedGood, _ := Encrypt(bKeyGood, "good")
+	legacyZero := strings.TrimPrefix(sealedZero, "cryco:v1:aesgcm::")
+
+	tests := []struct {
+		name        string
+		env         string
+		allowZero   bool
+		wantKey     []byte
+		wantErrType error
+	}{
+		{"no key", "", false, nil, ErrNoKey},
+		{"no key allowed", "", true, bKeyZero, nil},
+		{"bad key", keyBadB64, false, nil, ErrBase64},
+		{"good key", keyGoodB64, false, bKeyGood, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStrict(true)
+			AllowInsecureZeroKey(tt.allowZero)
+			defer SetStrict(false)
+			defer AllowInsecureZeroKey(false)
+			os.Unsetenv(envKeyName)
+			if tt.env != "" {
+				os.Setenv(envKeyName, tt.env)
+				defer os.Unsetenv(envKeyName)
+			}
+
+			got, err := GetKey()
+			if !errors.Is(err, tt.wantErrType) || !reflect.DeepEqual(got, tt.wantKey) {
+				t.Errorf("GetKey() = %v %v, want %v %v", got, err, tt.wantKey, tt.wantErrType)
+			}
+			kr, err := GetKeyring()
+			if !errors.Is(err, tt.wantErrType) {
+				t.Errorf("GetKeyring() error = '%v', wantErr '%v'", err, tt.wantErrType)
+			}
+			if err == nil && !reflect.DeepEqual(kr.Keys()[0].Bytes, tt.wantKey) {
+				t.Errorf("GetKeyring() = %v, want %v", kr.Keys(), tt.wantKey)
+			}
+			var s struct {
+				S string `fil:"S"`
+			}
+			err = ParseReaders(&s, []io.Reader{strings.NewReader("S = (clear)\n")})
+			if !errors.Is(err, tt.wantErrType) {
+				t.Errorf("ParseReaders() error = '%v', wantErr '%v'", err, tt.wantErrType)
+			}
+		})
+	}
+
+	t.Run("zero key refused", func(t *testing.T) {
+		SetStrict(true)
+		defer SetStrict(false)
+		if !Strict() {
+			t.Errorf("Strict() = false after SetStrict(true)")
+		}
+		for _, value := range []string{sealedZero, legacyZero} {
+			if _, err := Decrypt(bKeyZero, value); !errors.Is(err, ErrNoKey) {
+				t.Errorf("Decrypt() error = '%v', wantErr '%v'", err, ErrNoKey)
+			}
+		}
+		if _, err := Encrypt(bKeyZero, "zero"); !errors.Is(err, ErrNoKey) {
+			t.Errorf("Encrypt() error = '%v', wantErr '%v'", err, ErrNoKey)
+		}
+		if got, err := Decrypt(bKeyZero, "(clear)"); err != nil || got != "clear" {
+			t.Errorf("Decrypt() of cleartext = %v %v", got, err)
+		}
+		if got, err := Decrypt(bKeyGood, sealedGood); err != nil || got != "good" {
+			t.Errorf("Decrypt() = %v %v, want good", got, err)
+		}
+		AllowInsecureZeroKey(true)
+		defer AllowInsecureZeroKey(false)
+		if got, err := Decrypt(bKeyZero, sealedZero); err != nil || got != "zero" {
+			t.Errorf("Decrypt() with zero key allowed = %v %v, want zero", got, err)
+		}
+	})
+}
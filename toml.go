@@ -0,0 +1,43 @@
+package cryco
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Parses the TOML document in the reader, returning true if it had any values. Tables
+// map onto nested structs and arrays of tables onto slices of structs. Strings may be
+// encrypted while numbers, booleans and dates are taken as is.
+func parseTOML(struc interface{}, kr *Keyring, r io.Reader) (bool, error) {
+	var doc map[string]interface{}
+	if _, err := toml.NewDecoder(r).Decode(&doc); err != nil {
+		return false, fmt.Errorf("%w %v", ErrBadFileFormat, err)
+	}
+	return setFromTree(struc, kr, tomlTree(doc).(map[string]interface{}))
+}
+
+// Converts the decoded TOML to a document for setFromTree, where arrays of tables
+// are arrays of objects
+func tomlTree(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		for k, c := range n {
+			n[k] = tomlTree(c)
+		}
+		return n
+	case []map[string]interface{}:
+		s := make([]interface{}, len(n))
+		for i, c := range n {
+			s[i] = tomlTree(c)
+		}
+		return s
+	case []interface{}:
+		for i, c := range n {
+			n[i] = tomlTree(c)
+		}
+		return n
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package cryco
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseTOML(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.EncryptWithOptions("secret", Options{Name: "db.password"})
+
+	type db struct {
+		Host     string `fil:"host"`
+		Password string `fil:"password"`
+	}
+	type server struct {
+		Name string `fil:"name"`
+		Port int64  `fil:"port"`
+	}
+	type testStruct struct {
+		Name    string   `fil:"name"`
+		Ratio   float64  `fil:"ratio"`
+		Debug   bool     `fil:"debug"`
+		Hosts   []string `fil:"hosts"`
+		DB      db       `fil:"db"`
+		User    string   `fil:"db.user"`
+		Servers []server `fil:"servers"`
+	}
+	tests := []struct {
+		name          string
+		toml          string
+		want          testStruct
+		wantProcessed bool
+		wantErr       bool
+		wantErrType   error
+	}{
+		{"empty", "", testStruct{}, false, false, nil},
+		{"values", "name = '(app)'\nratio = 0.5\ndebug = true\nhosts = ['(a)', '(b)']\n\n[db]\nhost = '(db)'\npassword = '" + sealed + "'\nuser = '(admin)'\n",
+			testStruct{Name: "app", Ratio: 0.5, Debug: true, Hosts: []string{"a", "b"}, DB: db{"db", "secret"}, User: "admin"}, true, false, nil},
+		{"arrays of tables", "[[servers]]\nname = '(x)'\nport = 1\n\n[[servers]]\nname = '(y)'\nport = 2\n",
+			testStruct{Servers: []server{{"x", 1}, {"y", 2}}}, true, false, nil},
+		{"dotted keys", "db.host = '(db)'\n", testStruct{DB: db{Host: "db"}}, true, false, nil},
+		{"syntax", "name = '(app)'\n[db\n", testStruct{}, false, true, ErrBadFileFormat},
+		{"bad ciphertext", "[db]\nhost = '" + badBase64 + "'\n", testStruct{}, false, true, ErrBase64},
+		{"bad type", "ratio = 'x'\n", testStruct{}, false, true, ErrBase64},
+		{"table without struct", "[name]\nx = 1\n", testStruct{}, true, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			processed, err := parseTOML(&got, kr, strings.NewReader(tt.toml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTOML() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) {
+					t.Errorf("parseTOML() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				}
+				return
+			}
+			if got.Name != tt.want.Name || got.Ratio != tt.want.Ratio || got.Debug != tt.want.Debug || got.User != tt.want.User ||
+				strings.Join(got.Hosts, ",") != strings.Join(tt.want.Hosts, ",") || got.DB != tt.want.DB ||
+				len(got.Servers) != len(tt.want.Servers) || processed != tt.wantProcessed {
+				t.Errorf("parseTOML() = %+v %v, want %+v %v", got, processed, tt.want, tt.wantProcessed)
+				return
+			}
+			for i := range got.Servers {
+				if got.Servers[i] != tt.want.Servers[i] {
+					t.Errorf("parseTOML() servers = %+v, want %+v", got.Servers, tt.want.Servers)
+				}
+			}
+		})
+	}
+	t.Run("syntax line", func(t *testing.T) {
+		var got testStruct
+		if _, err := parseTOML(&got, kr, strings.NewReader("name = '(app)'\nratio = = 1\ndebug = true\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("parseTOML() error = %v, want line 2", err)
+		}
+	})
+}
+
+func TestParseFilesTOML(t *testing.T) {
+	var s struct {
+		I int64  `fil:"I"`
+		S string `fil:"S"`
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.toml")
+	os.WriteFile(config, []byte("I = 5\nS = '"+cipherOne+"'\n"), 0600)
+	if err := ParseFilesWith(StaticProvider{{Bytes: bKeyGood}}, &s, config); err != nil || s.I != 5 || s.S != "One" {
+		t.Errorf("ParseFilesWith() = %+v %v", s, err)
+	}
+	r := WithFormat(strings.NewReader("S = '(two)'\n"), FormatTOML)
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s, []io.Reader{r}); err != nil || s.S != "two" {
+		t.Errorf("ParseReadersWith() = %+v %v", s, err)
+	}
+}
@@ -0,0 +1,129 @@
+package cryco
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// Values encrypted to a recipient public key use the x25519 algorithm. A new
+// ephemeral X25519 key pair is generated for every value and the AES-256-GCM
+// key is derived using HKDF-SHA256 from the shared secret between the ephemeral
+// private key and the recipient public key. The payload is the ephemeral public
+// key followed by the nonce and sealed data, so only the holder of the recipient
+// private key can decrypt the value.
+
+const (
+	// AlgX25519 is X25519 key agreement with an ephemeral key followed by AES-256-GCM
+	AlgX25519 = "x25519"
+
+	x25519KeySize = 32
+	x25519Info    = "cryco x25519"
+)
+
+// GenerateKeyPair returns a new X25519 private and public key. The public key is
+// used by EncryptTo, the private key is used as the key when decrypting.
+func GenerateKeyPair() (privateKey []byte, publicKey []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	return priv.Bytes(), priv.PublicKey().Bytes(), nil
+}
+
+// PublicKey returns the X25519 public key belonging to the private key
+func PublicKey(privateKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w %d", ErrKeySize, len(privateKey))
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+// EncryptTo encrypts the plaintext so that it can only be decrypted by the holder of the
+// private key belonging to the X25519 public key
+func EncryptTo(publicKey []byte, plaintext string, opts Options) (string, error) {
+	pub, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w %d", ErrKeySize, len(publicKey))
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	bKey, err := x25519Key(eph, pub, eph.PublicKey(), pub)
+	if err != nil {
+		return "", err
+	}
+	e := newEnvelope(AlgX25519, opts)
+	if opts.Fingerprint {
+		e.ext = append(e.ext, extFP+"="+KeyFingerprint(publicKey))
+	}
+	if !keyIDRegexp.MatchString(e.KeyID) {
+		return "", fmt.Errorf("%w (%s)", ErrKeyID, e.KeyID)
+	}
+	aead, err := e.aead(bKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), e.additionalData(opts.Name))
+	if err != nil {
+		return "", err
+	}
+	payload := append(eph.PublicKey().Bytes(), sealed...)
+	return e.header() + base64.URLEncoding.EncodeToString(payload), nil
+}
+
+// Encrypts the plaintext to the public key of the primary key of the keyring, taken as an
+// X25519 private key, recording the ID of the key
+func (kr *Keyring) encryptToPrimary(plaintext string, opts Options) (string, error) {
+	if len(kr.keys) == 0 {
+		return "", fmt.Errorf("%w no keys in keyring", ErrInvalidKey)
+	}
+	pub, err := PublicKey(kr.keys[0].Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%w, the primary key is not an x25519 private key", err)
+	}
+	opts.KeyID = kr.keys[0].ID
+	return EncryptTo(pub, plaintext, opts)
+}
+
+// Splits the ephemeral public key from the payload and returns the AES key derived
+// using the recipient private key together with the rest of the payload
+func openX25519(privateKey []byte, payload []byte) ([]byte, []byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		// Not the key rather than an error, so keyrings go on trying their other keys
+		return nil, nil, fmt.Errorf("%w, %d byte key is not an x25519 private key", ErrInvalidKey, len(privateKey))
+	}
+	if len(payload) < x25519KeySize {
+		return nil, nil, fmt.Errorf("%w (c)", ErrInternal)
+	}
+	eph, err := ecdh.X25519().NewPublicKey(payload[:x25519KeySize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %v", ErrInvalidKey, err)
+	}
+	bKey, err := x25519Key(priv, eph, eph, priv.PublicKey())
+	if err != nil {
+		return nil, nil, err
+	}
+	return bKey, payload[x25519KeySize:], nil
+}
+
+// Derives the AES-256 key from the shared secret between the private and public key.
+// The ephemeral and recipient public keys are used as salt so the key is bound to both.
+func x25519Key(priv *ecdh.PrivateKey, pub *ecdh.PublicKey, ephPub *ecdh.PublicKey, recipientPub *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInvalidKey, err)
+	}
+	salt := append(ephPub.Bytes(), recipientPub.Bytes()...)
+	bKey, err := hkdf.Key(sha256.New, shared, salt, x25519Info, KeySize256)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrInternal, err)
+	}
+	return bKey, nil
+}
@@ -0,0 +1,114 @@
+package cryco
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	priv1, pub1, err1 := GenerateKeyPair()
+	priv2, pub2, err2 := GenerateKeyPair()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("GenerateKeyPair() error = %v %v", err1, err2)
+	}
+	if len(priv1) != 32 || len(pub1) != 32 || string(priv1) == string(priv2) || string(pub1) == string(pub2) {
+		t.Errorf("GenerateKeyPair() = %v %v", priv1, pub1)
+	}
+	if got, err := PublicKey(priv1); err != nil || string(got) != string(pub1) {
+		t.Errorf("PublicKey() = %v %v, want %v", got, err, pub1)
+	}
+	if _, err := PublicKey(bKeyGood); !errors.Is(err, ErrKeySize) {
+		t.Errorf("PublicKey() error = '%v', wantErr '%v'", err, ErrKeySize)
+	}
+}
+
+func TestEncryptTo(t *testing.T) {
+	priv, pub, _ := GenerateKeyPair()
+	otherPriv, _, _ := GenerateKeyPair()
+
+	sealed, err := EncryptTo(pub, "s3cret", Options{KeyID: "prod"})
+	if err != nil {
+		t.Fatalf("EncryptTo() error = %v", err)
+	}
+	if !strings.HasPrefix(sealed, "cryco:v1:x25519:prod:") {
+		t.Errorf("EncryptTo() = %v, want x25519 envelope", sealed)
+	}
+	bound, _ := EncryptTo(pub, "s3cret", Options{Name: "DB_PASSWORD"})
+	payload := sealed[strings.LastIndex(sealed, ":")+1:]
+
+	tests := []struct {
+		name        string
+		bKey        []byte
+		value       string
+		tagName     string
+		want        string
+		wantErr     bool
+		wantErrType error
+	}{
+		{"private key", priv, sealed, "", "s3cret", false, nil},
+		{"other private key", otherPriv, sealed, "", "", true, ErrInvalidKey},
+		{"public key", pub, sealed, "", "", true, ErrInvalidKey},
+		{"short key", bKeyGood, sealed, "", "", true, ErrInvalidKey},
+		{"altered header", priv, "cryco:v1:x25519:test:" + payload, "", "", true, ErrInvalidKey},
+		{"as aesgcm", priv, "cryco:v1:aesgcm:prod:" + payload, "", "", true, ErrInvalidKey},
+		{"short payload", priv, "cryco:v1:x25519::" + shortCipher, "", "", true, ErrInternal},
+		{"bound", priv, bound, "DB_PASSWORD", "s3cret", false, nil},
+		{"bound swapped", priv, bound, "API_URL", "", true, ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptWithName(tt.bKey, tt.value, tt.tagName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecryptWithName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, tt.wantErrType) {
+				t.Errorf("DecryptWithName() error = '%v', wantErr '%v'", err, tt.wantErrType)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("DecryptWithName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := EncryptTo(pub[:16], "s3cret", Options{}); !errors.Is(err, ErrKeySize) {
+		t.Errorf("EncryptTo() error = '%v', wantErr '%v'", err, ErrKeySize)
+	}
+	if _, err := EncryptTo(pub, "s3cret", Options{KeyID: "a:b"}); !errors.Is(err, ErrKeyID) {
+		t.Errorf("EncryptTo() error = '%v', wantErr '%v'", err, ErrKeyID)
+	}
+}
+
+func TestKeyringX25519Mixed(t *testing.T) {
+	priv, pub, _ := GenerateKeyPair()
+	sealed, _ := EncryptTo(pub, "s3cret", Options{})
+	// The AES-128 key first in the keyring is skipped as not being the private key
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood}, Key{Bytes: bKey192}, Key{Bytes: priv})
+	if got, err := kr.Decrypt(sealed); err != nil || got != "s3cret" {
+		t.Errorf("Keyring.Decrypt() = %v %v", got, err)
+	}
+	kr, _ = NewKeyring(Key{Bytes: bKeyGood})
+	if _, err := kr.Decrypt(sealed); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Keyring.Decrypt() error = '%v', wantErr '%v'", err, ErrInvalidKey)
+	}
+}
+
+func TestParseReadersX25519(t *testing.T) {
+	type testStruct struct {
+		S string `fil:"S"`
+	}
+	priv, pub, _ := GenerateKeyPair()
+	sealed, _ := EncryptTo(pub, "Recipient", Options{})
+
+	os.Setenv(envKeyName, base64.StdEncoding.EncodeToString(priv))
+	defer os.Unsetenv(envKeyName)
+	var got testStruct
+	if err := ParseReaders(&got, []io.Reader{strings.NewReader("S=" + sealed)}); err != nil || got.S != "Recipient" {
+		t.Errorf("ParseReaders() = %v %v", got, err)
+	}
+}
@@ -0,0 +1,132 @@
+package cryco
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Most nodes a YAML document may expand to. Aliases are expanded wherever they are used,
+// so a small document with aliases of aliases can expand to billions of nodes.
+const yamlMaxNodes = 100000
+
+// Parses the YAML mapping in the reader, returning true if it had any values. Strings
+// may be encrypted, a long ciphertext may be folded over several lines using a block
+// scalar, while numbers and booleans are taken as is. Errors give the line of the value.
+func parseYAML(struc interface{}, kr *Keyring, r io.Reader) (bool, error) {
+	var root yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w %v", ErrBadFileFormat, err)
+	}
+	nodes := 0
+	doc, err := yamlTree(&root, &nodes)
+	if err != nil {
+		return false, err
+	}
+	if doc == nil {
+		return false, nil
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("%w, not a YAML mapping at line %d", ErrBadFileFormat, root.Line)
+	}
+	return setFromTree(struc, kr, m)
+}
+
+// Converts the YAML node to a document for setFromTree, with the scalars and sequences
+// keeping their line numbers. The nodes converted are counted in nodes, failing when
+// there are more than yamlMaxNodes.
+func yamlTree(n *yaml.Node, nodes *int) (interface{}, error) {
+	if *nodes++; *nodes > yamlMaxNodes {
+		return nil, fmt.Errorf("%w, more than %d YAML nodes with aliases expanded at line %d", ErrBadFileFormat, yamlMaxNodes, n.Line)
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlTree(n.Content[0], nodes)
+	case yaml.AliasNode:
+		return yamlTree(n.Alias, nodes)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			node, err := yamlTree(v, nodes)
+			if err != nil {
+				return nil, err
+			}
+			// Merge the keys of the mapping, or sequence of mappings, given by <<. Keys of the
+			// mapping itself and of earlier mappings in the sequence take precedence.
+			if k.Tag == "!!merge" {
+				merges := []interface{}{node}
+				if seq, ok := node.(lineNode); ok {
+					merges, _ = seq.node.([]interface{})
+				}
+				for _, merge := range merges {
+					merged, ok := merge.(map[string]interface{})
+					if !ok {
+						return nil, fmt.Errorf("%w, bad merge at line %d", ErrBadFileFormat, k.Line)
+					}
+					for mk, mv := range merged {
+						if _, ok := m[mk]; !ok {
+							m[mk] = mv
+						}
+					}
+				}
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("%w, key is not a scalar at line %d", ErrBadFileFormat, k.Line)
+			}
+			m[k.Value] = node
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]interface{}, len(n.Content))
+		for i, c := range n.Content {
+			node, err := yamlTree(c, nodes)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = node
+		}
+		return lineNode{node: s, line: n.Line}, nil
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!str":
+			return lineNode{node: yamlString(n), line: n.Line}, nil
+		}
+		// Numbers, booleans and timestamps as written
+		return lineNode{node: yamlValue(n.Value), line: n.Line}, nil
+	}
+	return nil, fmt.Errorf("%w, unexpected YAML node at line %d", ErrBadFileFormat, n.Line)
+}
+
+// Returns the string of the scalar. The final line break of block scalars is dropped,
+// and a ciphertext folded over several lines is joined again.
+func yamlString(n *yaml.Node) string {
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		return n.Value
+	}
+	s := strings.TrimRight(n.Value, "\n")
+	if joined := strings.Join(strings.Fields(s), ""); IsEnvelope(joined) {
+		return joined
+	}
+	return s
+}
+
+// A scalar that is not a string, set as is without decrypting it
+type yamlValue string
+
+// String returns the scalar as written
+func (v yamlValue) String() string {
+	return string(v)
+}
@@ -0,0 +1,103 @@
+package cryco
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseYAML(t *testing.T) {
+	kr, _ := NewKeyring(Key{Bytes: bKeyGood})
+	sealed, _ := kr.EncryptWithOptions("secret", Options{Name: "db.password"})
+	folded := "  password: >-\n    " + sealed[:20] + "\n    " + sealed[20:] + "\n"
+	// Nine levels of nine aliases expand to 9^9 strings
+	laughs := "l0: &l0 [(lol), (lol), (lol), (lol), (lol), (lol), (lol), (lol), (lol)]\n"
+	for i := 1; i < 9; i++ {
+		prev := fmt.Sprintf("*l%d", i-1)
+		laughs += fmt.Sprintf("l%d: &l%d [%s]\n", i, i, strings.TrimSuffix(strings.Repeat(prev+", ", 9), ", "))
+	}
+	laughs += "hosts: *l8\n"
+
+	type db struct {
+		Host     string `fil:"host"`
+		Password string `fil:"password"`
+	}
+	type testStruct struct {
+		Name  string   `fil:"name"`
+		Port  int64    `fil:"port"`
+		Debug bool     `fil:"debug"`
+		Text  string   `fil:"text"`
+		Hosts []string `fil:"hosts"`
+		DB    db       `fil:"db"`
+	}
+	tests := []struct {
+		name          string
+		yaml          string
+		want          testStruct
+		wantProcessed bool
+		wantErr       bool
+		wantErrType   error
+		wantLine      string
+	}{
+		{"empty", "", testStruct{}, false, false, nil, ""},
+		{"comment", "# nothing\n", testStruct{}, false, false, nil, ""},
+		{"values", "name: (app)\nport: 8080\ndebug: true\nhosts:\n  - (a)\n  - (b)\ndb:\n  host: (db)\n  password: " + sealed + "\n",
+			testStruct{"app", 8080, true, "", []string{"a", "b"}, db{"db", "secret"}}, true, false, nil, ""},
+		{"flow", "hosts: [(a), (b)]\ndb: {host: (db)}\n", testStruct{Hosts: []string{"a", "b"}, DB: db{Host: "db"}}, true, false, nil, ""},
+		{"literal", "text: |\n  (line 1\n  line 2)\n", testStruct{Text: "line 1\nline 2"}, true, false, nil, ""},
+		{"folded ciphertext", "db:\n" + folded, testStruct{DB: db{Password: "secret"}}, true, false, nil, ""},
+		{"anchors", "base: &b\n  host: (db)\ndb:\n  <<: *b\n", testStruct{DB: db{Host: "db"}}, true, false, nil, ""},
+		{"merge sequence", "a: &a\n  host: (a)\nb: &b\n  host: (b)\n  password: (b)\ndb:\n  <<: [*a, *b]\n", testStruct{DB: db{"a", "b"}}, true, false, nil, ""},
+		{"merge overridden", "a: &a\n  host: (a)\ndb:\n  <<: *a\n  host: (db)\n", testStruct{DB: db{Host: "db"}}, true, false, nil, ""},
+		{"bad merge", "db:\n  <<: [(a)]\n", testStruct{}, false, true, ErrBadFileFormat, "line 2"},
+		{"nested aliases", laughs, testStruct{}, false, true, ErrBadFileFormat, "YAML nodes"},
+		{"null", "name: ~\n", testStruct{}, true, false, nil, ""},
+		{"not mapping", "- a\n", testStruct{}, false, true, ErrBadFileFormat, "line 1"},
+		{"syntax", "name: (a)\n  port: 1\n", testStruct{}, false, true, ErrBadFileFormat, "line 2"},
+		{"bad ciphertext", "name: (a)\n\ndb:\n  host: " + badBase64 + "\n", testStruct{}, false, true, ErrBase64, "line 4"},
+		{"bad number", "port: 1.5\n", testStruct{}, false, true, ErrParse, "line 1"},
+		{"sequence to scalar", "name:\n  - (a)\n", testStruct{}, false, true, ErrBadFileFormat, "line 2"},
+		{"quoted", "port: \"(8080)\"\nname: '(a: b)'\n", testStruct{Name: "a: b", Port: 8080}, true, false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testStruct
+			processed, err := parseYAML(&got, kr, strings.NewReader(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseYAML() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.wantErrType) || !strings.Contains(err.Error(), tt.wantLine) {
+					t.Errorf("parseYAML() error = '%v', wantErr '%v' at %s", err, tt.wantErrType, tt.wantLine)
+				}
+				return
+			}
+			if got.Name != tt.want.Name || got.Port != tt.want.Port || got.Debug != tt.want.Debug || got.Text != tt.want.Text ||
+				strings.Join(got.Hosts, ",") != strings.Join(tt.want.Hosts, ",") || got.DB != tt.want.DB || processed != tt.wantProcessed {
+				t.Errorf("parseYAML() = %+v %v, want %+v %v", got, processed, tt.want, tt.wantProcessed)
+			}
+		})
+	}
+}
+
+func TestParseFilesYAML(t *testing.T) {
+	var s struct {
+		I int64  `fil:"I"`
+		S string `fil:"S"`
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yml")
+	os.WriteFile(config, []byte("I: 5\nS: "+cipherOne+"\n"), 0600)
+	if err := ParseFilesWith(StaticProvider{{Bytes: bKeyGood}}, &s, config); err != nil || s.I != 5 || s.S != "One" {
+		t.Errorf("ParseFilesWith() = %+v %v", s, err)
+	}
+	r := WithFormat(strings.NewReader("S: (two)\n"), FormatYAML)
+	if err := ParseReadersWith(StaticProvider{{Bytes: bKeyGood}}, &s, []io.Reader{r}); err != nil || s.S != "two" {
+		t.Errorf("ParseReadersWith() = %+v %v", s, err)
+	}
+}